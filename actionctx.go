@@ -3,6 +3,7 @@ package lazydispatch
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"reflect"
 	"runtime/debug"
@@ -12,118 +13,161 @@ import (
 )
 
 type actionctx struct {
-	t            reflect.Type
-	befores      []methodInfo
-	afters       []methodInfo
-	ErrorHandler *methodInfo
-	generators   map[string]methodInfo
-	action       methodInfo
-	pool         sync.Pool
-	tt           reflect.Type
-	vv           reflect.Value
-	ctxfn        []func(ctx context.Context, r *http.Request) context.Context
+	t             reflect.Type
+	befores       []methodInfo
+	afters        []methodInfo
+	ErrorHandler  *methodInfo
+	generators    map[string]*methodInfo
+	action        methodInfo
+	name          string    // name is the name of the action, even when it only has variants
+	variants      []variant // variants answer the action in a format, in order of preference
+	onlyVariants  bool      // onlyVariants is set when there is no method for the action itself
+	pool          sync.Pool
+	tt            reflect.Type
+	vv            reflect.Value
+	ctxfn         []func(ctx context.Context, r *http.Request) context.Context
+	providers     map[reflect.Type]provider
+	needsRoute    bool // needsRoute is set when any method asks for the *Route or path parameters
+	logger        *slog.Logger
+	instrumenters []Instrumenter
+	errorHandlers []ErrorHandlerFunc
+	renderers     []renderer
+	notAcceptable http.Handler                  // notAcceptable answers the formats without a variant, set by Draw
+	errorPage     func(status int) http.Handler // errorPage answers the errors no handler took, set by Draw
 	// TODO: fill thoose and pass them to the action somehow
 }
 
 func (actx *actionctx) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var err error
 
-	/*
-		defer func() {
-			if err := recover(); err != nil {
-				fmt.Println("ERROR:", err)
-				if err, ok := err.(error); ok {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-				} else {
-					http.Error(w, fmt.Sprintf("%+v", err), http.StatusInternalServerError)
-				}
-				panic(err)
-			}
-		}()
-	*/
+	// If provided, allow the caller to ForAction to modify the request context
+	if len(actx.ctxfn) > 0 {
+		r = r.WithContext(actx.ctxfn[0](r.Context(), r))
+	}
 
-	lazysupport.MeasureText(" └DONE:", func() error {
-		fmt.Printf("\n%s %s => %s#%s\n", r.Method, r.URL.Path, actx.tt.String(), actx.action.name)
+	sw := &statusRecorder{ResponseWriter: w}
+	w = sw
+	t := newTracker(actx, r)
+	if t != nil {
+		r = t.startRequest(r)
+		defer t.finishRequest(r, sw)
+	}
 
-		// If provided, allow the caller to ForAction to modify the request context
-		if len(actx.ctxfn) > 0 {
-			r = r.WithContext(actx.ctxfn[0](r.Context(), r))
+	// Instanciate
+	instance := actx.pool.Get().(*reflect.Value)
+	defer func() {
+		// TODO: See if the request was hijacked
+		actx.pool.Put(instance)
+	}()
+	// Copy initial values
+	instance.Elem().Set(actx.vv)
+
+	cctx := callctx{actx: actx, instance: *instance, w: w, r: r, tracker: t}
+	if actx.needsRoute {
+		if route := RouteFrom(r.Context()); route != nil {
+			cctx.route = route
+			cctx.params = route.paramsInfo().values(r.URL.Path, SubdomainsFrom(r.Context()))
 		}
+	}
 
-		// Instanciate
-		instance := actx.pool.Get().(*reflect.Value)
-		defer func() {
-			// TODO: See if the request was hijacked
-			actx.pool.Put(instance)
-		}()
-		// Copy initial values
-		instance.Elem().Set(actx.vv)
-
-		// Call before filters
-		for _, before := range actx.befores {
-			err = lazysupport.MeasureText(" ├╴"+before.name, func() error {
-				return actx.callFilter(before, *instance, w, r)
-			})
-			if err == errStop {
-				return errStop
-			}
-			if err != nil {
-				panic(err)
-			}
+	// Pick the method for the format before running any filter
+	action, ok := actx.methodFor(FormatFrom(r.Context()))
+	if !ok {
+		actx.serveNotAcceptable(w, r)
+		return
+	}
+
+	// Call before filters
+	for _, before := range actx.befores {
+		err = t.measure(EventFilter, cctx.withMethod(before), actx.callFilter)
+		if err == errStop {
+			return
+		}
+		if err != nil {
+			panic(err)
 		}
+	}
+
+	// Call action
+	var outs = []reflect.Value{}
 
-		// Call action
-		var outs = []reflect.Value{}
-
-		err := lazysupport.MeasureText(" ├╴"+actx.action.name, func() (err error) {
-			cctx := callctx{actx, actx.action, *instance, w, r, nil, nil}
-			defer func() {
-				p := recover()
-				if p != nil {
-					pa := lazysupport.NewPanic(p, debug.Stack(), 1)
-					callPanicHandler(cctx, pa)
-					err = errStop
-					return
+	err = t.measure(EventAction, cctx.withMethod(action), func(cctx callctx) (err error) {
+		defer func() {
+			p := recover()
+			if p != nil {
+				if u, ok := p.(unhandledError); ok {
+					panic(u)
 				}
-			}()
-			outs, err = call(cctx)
-			// If any gen returns an error, we stop the execution
-			if err == errStop {
-				return err
-			}
-			if err != nil {
-				panic(err)
+				pa := lazysupport.NewPanic(p, debug.Stack(), 1)
+				callPanicHandler(cctx, pa)
+				err = errStop
+				return
 			}
-			return processActionOutput(&callctx{actx, actx.action, *instance, w, r, nil, nil}, outs, w)
-		})
+		}()
+		outs, err = call(cctx)
+		// If any gen returns an error, we stop the execution
 		if err == errStop {
-			return nil
+			return err
 		}
 		if err != nil {
 			panic(err)
 		}
+		return processActionOutput(&cctx, outs, cctx.w)
+	})
+	if err == errStop {
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
 
-		// Call after filters
-		for _, after := range actx.afters {
-			err = lazysupport.MeasureText(" ├╴"+after.name, func() error {
-				return actx.callFilter(after, *instance, w, r)
-			})
-			if err == errStop {
-				return nil
-			}
-			if err != nil {
-				panic(err)
-			}
+	// Call after filters
+	for _, after := range actx.afters {
+		err = t.measure(EventAfterFilter, cctx.withMethod(after), actx.callFilter)
+		if err == errStop {
+			return
 		}
-		return nil
-	})
+		if err != nil {
+			panic(err)
+		}
+	}
+}
 
+// serveNotAcceptable answers the requests for a format the action can't produce
+func (actx *actionctx) serveNotAcceptable(w http.ResponseWriter, r *http.Request) {
+	notAcceptable := actx.notAcceptable
+	if notAcceptable == nil {
+		notAcceptable = defaultNotAcceptable
+	}
+	serveWithStatus(notAcceptable, http.StatusNotAcceptable, w, r)
+}
+
+// serveError answers an error that no handler took with the error page of its status.
+// When the response was already started the error is only logged.
+func (actx *actionctx) serveError(w http.ResponseWriter, r *http.Request, err error) {
+	status := StatusCode(err)
+	sw, _ := w.(*statusRecorder)
+	sent := sw != nil && sw.status != 0
+	logError(actx.logger, r, "unhandled error", err, status, sent, nil)
+	if sent {
+		return
+	}
+	var page http.Handler = defaultInternalServerError
+	if actx.errorPage != nil {
+		page = actx.errorPage(status)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), errorKey{}, err))
+	serveWithStatus(page, status, w, r)
 }
-func (actx *actionctx) callFilter(mi methodInfo, instance reflect.Value, w http.ResponseWriter, r *http.Request) (err error) {
-	cctx := callctx{actx, mi, instance, w, r, nil, nil}
+
+func (actx *actionctx) callFilter(cctx callctx) (err error) {
+	mi := cctx.mi
 
 	defer func() {
 		if p := recover(); p != nil {
+			if u, ok := p.(unhandledError); ok {
+				panic(u)
+			}
 			pa := lazysupport.NewPanic(p, debug.Stack(), 1)
 			callPanicHandler(cctx, pa)
 			err = errStop
@@ -141,21 +185,23 @@ func (actx *actionctx) callFilter(mi methodInfo, instance reflect.Value, w http.
 			panic(err)
 		}
 		if err != nil {
-			callErrorHandler(callctx{actx, mi, instance, w, r, nil, nil}, err)
+			callErrorHandler(cctx, err)
 			return errStop
 		}
 	}
 	return nil
 }
 
-func callGenerator(actx *actionctx, mi methodInfo, instance reflect.Value, w http.ResponseWriter, r *http.Request) (value reflect.Value, err error) {
-	// TODO: Check that out is not included in the input (infinit loop)
-	cctx := callctx{actx, mi, instance, w, r, nil, nil}
+func callGenerator(cctx callctx) (value reflect.Value, err error) {
+	mi := cctx.mi
 	var outs []reflect.Value
 
 	defer func() {
 		p := recover()
 		if p != nil {
+			if u, ok := p.(unhandledError); ok {
+				panic(u)
+			}
 			pa := lazysupport.NewPanic(p, debug.Stack(), 1)
 			callPanicHandler(cctx, pa)
 			err = errStop
@@ -163,6 +209,10 @@ func callGenerator(actx *actionctx, mi methodInfo, instance reflect.Value, w htt
 		}
 	}()
 	outs, err = call(cctx)
+	// A generator needed by this one already handled its error
+	if err == errStop {
+		return reflect.Value{}, err
+	}
 	if err != nil {
 		panic(err)
 	}
@@ -185,17 +235,8 @@ func callGenerator(actx *actionctx, mi methodInfo, instance reflect.Value, w htt
 	return outs[0], nil
 }
 
+// callPanicHandler passes a recovered panic to the ErrorHandler.
+// Without ErrorHandler the panic goes on to the recovery of the Dispatcher.
 func callPanicHandler(cctx callctx, err error) {
-	if cctx.actx.ErrorHandler == nil {
-		panic(err)
-	}
-	// Ensure we don't call the error handler twice
-	if cctx.err != nil {
-		panic(fmt.Errorf("double panic: %w", cctx.err))
-	}
-	cctx.err = err
-	_, err = call(cctx)
-	if err != nil {
-		panic(err)
-	}
+	callErrorHandler(cctx, err)
 }
@@ -7,43 +7,41 @@ import (
 	"io"
 	"net/http"
 	"reflect"
-	"strings"
 
 	"golazy.dev/lazysupport"
 )
 
 type callctx struct {
-	actx         *actionctx
-	mi           methodInfo
-	instance     reflect.Value
-	w            http.ResponseWriter
-	r            *http.Request
-	err          error
-	stringParams []string
+	actx     *actionctx
+	mi       methodInfo
+	instance reflect.Value
+	w        http.ResponseWriter
+	r        *http.Request
+	err      error
+	route    *Route   // route is the *Route from the request context, if the action needs it
+	params   []string // params are the path and subdomain parameters of the request, last one first
+	tracker  *tracker
+}
+
+// withMethod returns a copy of cctx to call mi
+func (cctx callctx) withMethod(mi methodInfo) callctx {
+	cctx.mi = mi
+	return cctx
 }
 
 func (cctx *callctx) fn() reflect.Value {
 	return cctx.instance.Method(cctx.mi.method)
 }
-func (cctx *callctx) fnT() reflect.Type {
-	return cctx.fn().Type()
-}
-func (cctx *callctx) fnIn(i int) reflect.Type {
-	return cctx.fnT().In(i)
-}
-func (cctx *callctx) NumIn() int {
-	return cctx.fnT().NumIn()
-}
 
+// call fills the inputs of the method following its plan and calls it
 func call(cctx callctx) ([]reflect.Value, error) {
-	nInputs := cctx.NumIn()
-	inputs := make([]reflect.Value, nInputs)
-	for n := 0; n < nInputs; n++ {
-		in, err := findInput(&cctx, cctx.fnIn(n))
+	inputs := make([]reflect.Value, len(cctx.mi.inputs))
+	for n, in := range cctx.mi.inputs {
+		v, err := findInput(&cctx, in)
 		if err != nil {
 			return []reflect.Value{}, err
 		}
-		inputs[n] = in
+		inputs[n] = v
 	}
 
 	return cctx.fn().Call(inputs), nil
@@ -55,6 +53,8 @@ func processActionOutput(cctx *callctx, outs []reflect.Value, w http.ResponseWri
 	var err error
 	var status int
 	var header *http.Header
+	var value any
+	rendered := false
 	for _, out := range outs {
 		switch v := out.Interface().(type) {
 		case nil:
@@ -90,7 +90,11 @@ func processActionOutput(cctx *callctx, outs []reflect.Value, w http.ResponseWri
 		case io.Reader:
 			reader = v
 		default:
-			panic(fmt.Sprintf("unknown output type %s", out.Type().Name()))
+			if !isRenderable(out) {
+				panic(fmt.Sprintf("unknown output type %s", out.Type().Name()))
+			}
+			value = v
+			rendered = true
 		}
 	}
 	if header != nil {
@@ -108,6 +112,15 @@ func processActionOutput(cctx *callctx, outs []reflect.Value, w http.ResponseWri
 		// panic(err)
 		// return
 	}
+	if rendered {
+		if body, err = render(cctx.actx.renderers, cctx.r, w.Header(), value); err == errNoRenderer {
+			cctx.actx.serveNotAcceptable(w, cctx.r)
+			return errStop
+		} else if err != nil {
+			callErrorHandler(*cctx, err)
+			return errStop
+		}
+	}
 	if status != 0 {
 		w.WriteHeader(status)
 	}
@@ -127,66 +140,82 @@ var (
 	tContextContext     = reflect.TypeFor[context.Context]()
 	tError              = reflect.TypeFor[error]()
 	tString             = reflect.TypeFor[string]()
+	tRoute              = reflect.TypeFor[*Route]()
+	tFormat             = reflect.TypeFor[Format]()
+	tSubdomains         = reflect.TypeFor[Subdomains]()
 )
 
-func findInput(ctx *callctx, t reflect.Type) (reflect.Value, error) {
-	name := t.String()
-	fmt.Println(name, tHTTPResponseWriter.String())
-	switch t {
-	case tHTTPRequest:
+func findInput(ctx *callctx, in inputPlan) (reflect.Value, error) {
+	switch in.source {
+	case sourceRequest:
 		return reflect.ValueOf(ctx.r), nil
-	case tHTTPResponseWriter:
-		return reflect.ValueOf(ctx.w), nil
-	case tContextContext:
+	case sourceResponseWriter:
+		return reflect.ValueOf(&ctx.w).Elem(), nil
+	case sourceContext:
 		return reflect.ValueOf(ctx.r.Context()), nil
-	case tError:
-		return reflect.ValueOf(ctx.err), nil
-	case tString:
-		if ctx.stringParams == nil {
-			r := ctx.r.Context().Value(reflect.TypeFor[*Route]())
-			if r == nil {
-				return reflect.Value{}, errors.New("string param can't be filled as there is no *Route in the context")
-			}
-			route := r.(*Route)
-			ctx.stringParams = extractParam(ctx.r.URL.Path, route.Path)
+	case sourceError:
+		return reflect.ValueOf(&ctx.err).Elem(), nil
+	case sourceRoute:
+		if ctx.route == nil {
+			return reflect.Value{}, fmt.Errorf("parameter %s needed by method %s#%s not found", in.t.String(), ctx.actx.t.String(), ctx.mi.name)
+		}
+		return reflect.ValueOf(ctx.route), nil
+	case sourcePathParam:
+		if ctx.route == nil {
+			return reflect.Value{}, errors.New("path param can't be filled as there is no *Route in the context")
 		}
-		if len(ctx.stringParams) == 0 {
+		if in.param >= len(ctx.params) {
 			return reflect.Value{}, fmt.Errorf("method %s#%s asked for more params than available", ctx.actx.t.String(), ctx.mi.name)
 		}
-		v := reflect.ValueOf(ctx.stringParams[0])
-		ctx.stringParams = ctx.stringParams[1:]
+		v, err := convertParam(in.t, ctx.params[in.param])
+		if err != nil {
+			callErrorHandler(*ctx, NotFound(fmt.Errorf("path parameter %s: %w", ctx.route.paramsInfo().names[in.param], err)))
+			return reflect.Value{}, errStop
+		}
 		return v, nil
+	case sourceParamStruct:
+		if ctx.route == nil {
+			return reflect.Value{}, fmt.Errorf("%s can't be filled as there is no *Route in the context", in.t.String())
+		}
+		return paramStruct(ctx, in)
+	case sourceFormat:
+		return reflect.ValueOf(FormatFrom(ctx.r.Context())), nil
+	case sourceSubdomains:
+		return reflect.ValueOf(SubdomainsFrom(ctx.r.Context())), nil
+	case sourceGenerator:
+		var val reflect.Value
+		err := ctx.tracker.measure(EventGenerator, ctx.withMethod(*in.generator), func(cctx callctx) (err error) {
+			val, err = callGenerator(cctx)
+			return err
+		})
+		return val, err
 	}
-	// Check for basic types
-	name = t.String()
 
-	// Try to find a generator
-	for gName, generator := range ctx.actx.generators {
-		if gName == name {
-			var val reflect.Value
-			var err error
-			lazysupport.MeasureText(" ├╴"+generator.name, func() error {
-				val, err = callGenerator(ctx.actx, generator, ctx.instance, ctx.w, ctx.r)
-				if err != nil {
-					return err
-				}
-				return nil
-			})
-			return val, err
+	// Or from a provider
+	if p, ok := ctx.actx.providers[in.t]; ok {
+		val, err := p.call(ctx.r)
+		if err != nil {
+			callErrorHandler(*ctx, err)
+			return reflect.Value{}, errStop
 		}
+		return val, nil
 	}
 
 	// Or get it from the context
-	out := ctx.r.Context().Value(t)
+	out := ctx.r.Context().Value(in.t)
 	if out != nil {
 		return reflect.ValueOf(out), nil
 	}
-	return reflect.Value{}, fmt.Errorf("parameter %s needed by method %s#%s not found", name, ctx.actx.t.String(), ctx.mi.name)
+	return reflect.Value{}, fmt.Errorf("parameter %s needed by method %s#%s not found", in.t.String(), ctx.actx.t.String(), ctx.mi.name)
 }
 
 func callErrorHandler(cctx callctx, err error) {
+	if cctx.tracker != nil {
+		cctx.tracker.err = err
+	}
 	if cctx.actx.ErrorHandler == nil {
-		panic(err)
+		callDispatcherErrorHandlers(cctx, err)
+		return
 	}
 	// Ensure we don't call the error handler twice
 	if cctx.err != nil {
@@ -194,25 +223,32 @@ func callErrorHandler(cctx callctx, err error) {
 	}
 	cctx.err = err
 	cctx.mi = *cctx.actx.ErrorHandler
-	_, err = call(cctx)
+	err = cctx.tracker.measure(EventErrorHandler, cctx, func(cctx callctx) error {
+		_, err := call(cctx)
+		return err
+	})
 	if err != nil {
 		panic(err)
 	}
 }
 
-func extractParam(url, path string) []string {
-
-	out := []string{}
-	tmplComp := strings.Split(path, "/")
-	urlComp := strings.Split(url, "/")
-	for i, c := range tmplComp {
-		if strings.HasPrefix(c, ":") {
-			out = append(out, urlComp[i])
-		}
+// callDispatcherErrorHandlers passes err to the handlers added with Dispatcher.OnError.
+// If none handles it, a panic goes up to the recovery of the Dispatcher, and an error
+// is answered with the error page of its status.
+func callDispatcherErrorHandlers(cctx callctx, err error) {
+	handled := false
+	cctx.err = err
+	cctx.mi = methodInfo{name: "OnError"}
+	cctx.tracker.measure(EventErrorHandler, cctx, func(cctx callctx) error {
+		handled = handleError(cctx.actx.errorHandlers, cctx.w, cctx.r, err)
+		return nil
+	})
+	if handled {
+		return
 	}
-	//reverse it
-	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
-		out[i], out[j] = out[j], out[i]
+	var pa *lazysupport.Panic
+	if errors.As(err, &pa) {
+		panic(unhandledError{err})
 	}
-	return out
+	cctx.actx.serveError(cctx.w, cctx.r, err)
 }
@@ -0,0 +1,91 @@
+// lazyroutes prints the route table of a lazydispatch application, like rails routes.
+//
+// It reads the JSON produced by Dispatcher.Inspect from stdin (or from the file given as argument).
+// The application only has to dump its routes, for example:
+//
+//	if len(os.Args) > 1 && os.Args[1] == "routes" {
+//		json.NewEncoder(os.Stdout).Encode(dispatcher.Inspect())
+//		return
+//	}
+//
+// And then:
+//
+//	go run . routes | lazyroutes -controller Posts
+//	go run . routes | lazyroutes -name post -json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"golazy.dev/lazydispatch"
+)
+
+func main() {
+	controller := flag.String("controller", "", "only show routes whose controller contains this value")
+	name := flag.String("name", "", "only show routes whose name contains this value")
+	asJSON := flag.Bool("json", false, "print the routes as JSON")
+	flag.Parse()
+
+	var in io.Reader = os.Stdin
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	routes := []lazydispatch.RouteInfo{}
+	if err := json.NewDecoder(in).Decode(&routes); err != nil {
+		fmt.Fprintf(os.Stderr, "can't read routes: %s\n", err)
+		os.Exit(1)
+	}
+	routes = filter(routes, *controller, *name)
+
+	var err error
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(routes)
+	} else {
+		err = printTable(os.Stdout, routes)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// filter returns the routes that match both the controller and the name.
+// Empty values match every route. Matching is case insensitive.
+func filter(routes []lazydispatch.RouteInfo, controller, name string) []lazydispatch.RouteInfo {
+	out := []lazydispatch.RouteInfo{}
+	for _, r := range routes {
+		if !contains(r.Controller, controller) || !contains(r.Name, name) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+func contains(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func printTable(w io.Writer, routes []lazydispatch.RouteInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tMETHOD\tPATH\tTARGET\tMIDDLEWARES")
+	for _, r := range routes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Name, r.Method, r.Origin+r.Path, r.Target, strings.Join(r.Middlewares, ","))
+	}
+	return tw.Flush()
+}
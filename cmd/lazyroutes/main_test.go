@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"golazy.dev/lazydispatch"
+)
+
+var routes = []lazydispatch.RouteInfo{
+	{Method: "GET", Path: "/posts", Name: "posts", Controller: "PostsController", Target: "PostsController#Index"},
+	{Method: "GET", Path: "/posts/:post_id", Name: "post", Controller: "PostsController", Target: "PostsController#Show"},
+	{Method: "GET", Path: "/session", Name: "session", Controller: "SessionController", Target: "SessionController#Show"},
+}
+
+func TestFilter(t *testing.T) {
+	if out := filter(routes, "", ""); len(out) != 3 {
+		t.Errorf("expected 3 routes, got %d", len(out))
+	}
+	if out := filter(routes, "posts", ""); len(out) != 2 {
+		t.Errorf("expected 2 routes, got %d", len(out))
+	}
+	if out := filter(routes, "posts", "posts"); len(out) != 1 || out[0].Target != "PostsController#Index" {
+		t.Errorf("expected only PostsController#Index, got %+v", out)
+	}
+}
+
+func TestPrintTable(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := printTable(buf, routes[:2]); err != nil {
+		t.Fatal(err)
+	}
+	expected := "" +
+		"NAME   METHOD  PATH             TARGET                 MIDDLEWARES\n" +
+		"posts  GET     /posts           PostsController#Index  \n" +
+		"post   GET     /posts/:post_id  PostsController#Show   \n"
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,140 @@
+package lazydispatch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// checkRoutes panics if two routes are drawn with the same method and path, or with a subdomain
+// and no host, and logs the shadowed routes if WarnShadowedRoutes is set.
+// It also logs the routes with a wrong number of Models.
+func (d *Dispatcher) checkRoutes(routes []*Route) {
+	errs := routeConflicts(routes)
+	for _, route := range routes {
+		if route.Subdomain != "" && route.Host == "" {
+			errs = append(errs, fmt.Errorf("%s %s: subdomain %s has no host. Set one with Host, like Host(\"%s.example.com\")", route.Method, route.Path, route.Subdomain, route.Subdomain))
+		}
+	}
+	if len(errs) > 0 {
+		panic(errors.Join(errs...))
+	}
+	for _, route := range routes {
+		if err := route.modelsError(); err != nil {
+			d.warn(err.Error(), "route", route.Name)
+		}
+	}
+	if d.WarnShadowedRoutes {
+		for _, warning := range shadowedRoutes(routes) {
+			d.warn(warning)
+		}
+	}
+}
+
+// routeConflicts returns an error for every route that has the same method,
+// host and path of a route drawn before it. Parameter names are not relevant, so
+// /posts/:id and /posts/:post_id are the same path.
+func routeConflicts(routes []*Route) []error {
+	errs := []error{}
+	drawn := map[string]*Route{}
+	for _, route := range routes {
+		if route.Handler == nil {
+			continue
+		}
+		for _, method := range strings.Split(route.Method, ",") {
+			key := method + " " + route.origin() + pathPattern(route.Path)
+			if first, ok := drawn[key]; ok {
+				errs = append(errs, fmt.Errorf("route conflict: %s %s is drawn by %s and by %s", method, route.origin()+route.Path, routeDescription(first), routeDescription(route)))
+				continue
+			}
+			drawn[key] = route
+		}
+	}
+	return errs
+}
+
+// shadowedRoutes returns a warning for every route that has a static segment
+// where a route drawn before it, with the same method, has a :param segment.
+// For example GET /posts/search is shadowed by GET /posts/:post_id
+func shadowedRoutes(routes []*Route) []string {
+	warnings := []string{}
+	for j, route := range routes {
+		if route.Handler == nil {
+			continue
+		}
+		for _, earlier := range routes[:j] {
+			if earlier.Handler == nil || earlier.origin() != route.origin() {
+				continue
+			}
+			method, ok := sharedMethod(earlier.Method, route.Method)
+			if !ok || !shadows(earlier.Path, route.Path) {
+				continue
+			}
+			warnings = append(warnings, fmt.Sprintf("route %s %s (%s) is shadowed by %s %s (%s) drawn before it",
+				method, route.Path, routeDescription(route), method, earlier.Path, routeDescription(earlier)))
+			break
+		}
+	}
+	return warnings
+}
+
+// shadows reports if every request to path would be matched by the pattern
+// of earlier, and earlier uses a parameter where path has a static segment.
+func shadows(earlier, path string) bool {
+	eSegments := strings.Split(earlier, "/")
+	pSegments := strings.Split(path, "/")
+	hidden := false
+	for i, e := range eSegments {
+		if e == "*" {
+			return hidden || (i < len(pSegments) && pSegments[i] != "*")
+		}
+		if i >= len(pSegments) {
+			return false
+		}
+		p := pSegments[i]
+		switch {
+		case isParam(e) && !isParam(p) && p != "*":
+			hidden = true
+		case isParam(e) && isParam(p):
+		case e != p:
+			return false
+		}
+	}
+	return hidden && len(eSegments) == len(pSegments)
+}
+
+func sharedMethod(a, b string) (string, bool) {
+	for _, m := range strings.Split(b, ",") {
+		if hasMethod(a, m) {
+			return m, true
+		}
+	}
+	return "", false
+}
+
+func isParam(segment string) bool {
+	return strings.HasPrefix(segment, ":")
+}
+
+// pathPattern removes the parameter names of the path
+func pathPattern(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if isParam(s) {
+			segments[i] = ":"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// routeDescription identifies the route for error messages
+func routeDescription(r *Route) string {
+	switch {
+	case r.Target != "":
+		return r.Target
+	case r.Name != "":
+		return fmt.Sprintf("route %q", r.Name)
+	default:
+		return fmt.Sprintf("handler %T", r.Handler)
+	}
+}
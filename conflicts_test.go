@@ -0,0 +1,121 @@
+package lazydispatch
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+type ConflictsController struct{}
+
+func (*ConflictsController) New() string {
+	return "new"
+}
+
+func (*ConflictsController) GETNew() string {
+	return "get_new"
+}
+
+func expectDrawPanic(t *testing.T, d *Dispatcher, fn func(r *Scope), contains ...string) {
+	t.Helper()
+	defer func() {
+		t.Helper()
+		err := recover()
+		if err == nil {
+			t.Fatal("expected Draw to panic")
+		}
+		for _, c := range contains {
+			if !strings.Contains(fmt.Sprint(err), c) {
+				t.Errorf("expected panic %q to contain %q", err, c)
+			}
+		}
+	}()
+	d.Draw(fn)
+}
+
+func TestDraw_Conflicts(t *testing.T) {
+	expectDrawPanic(t, New(), func(r *Scope) {
+		r.Resources(&ConflictsController{})
+	}, "route conflict: GET /conflicts/new is drawn by ConflictsController#GETNew and by ConflictsController#New")
+
+	expectDrawPanic(t, New(), func(r *Scope) {
+		r.Resources(&PostsController{})
+		r.Resources(&PostsController{})
+	}, "GET /posts is drawn by PostsController#Index and by PostsController#Index",
+		"PUT /posts/:post_id is drawn by PostsController#Update and by PostsController#Update")
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	expectDrawPanic(t, New(), func(r *Scope) {
+		r.Get("/pages/:id").As("page").To(h)
+		r.Get("/pages/:page_id").To(h)
+	}, `GET /pages/:page_id is drawn by route "page" and by handler http.HandlerFunc`)
+
+	expectDrawPanic(t, New(), func(r *Scope) {
+		r.Host("api.example.com").Get("/pages").As("pages").To(h)
+		r.Get("//api.example.com/pages").To(h)
+	}, `GET //api.example.com/pages is drawn by route "pages" and by handler http.HandlerFunc`)
+}
+
+func TestDraw_NoConflicts(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Resources(&PostsController{})
+		r.Get("/pages/:id").To(h)
+		r.Post("/pages/:id").To(h)
+		r.Host("api.example.com").Get("/pages/:id").To(h)
+	})
+}
+
+func TestShadowedRoutes(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	d := New()
+	d.Logger(slog.New(slog.NewTextHandler(buf, nil)))
+	d.WarnShadowedRoutes = true
+	d.Draw(func(r *Scope) {
+		r.Get("/pages/:id").As("page").To(h)
+		r.Get("/pages/search").As("search_pages").To(h)
+		r.Post("/pages/preview").To(h)
+		r.Get("/files/*").As("files").To(h)
+		r.Get("/files/readme").As("readme").To(h)
+	})
+
+	out := buf.String()
+	expected := []string{
+		`level=WARN msg="route GET /pages/search (route \"search_pages\") is shadowed by GET /pages/:id (route \"page\") drawn before it"`,
+		`level=WARN msg="route GET /files/readme (route \"readme\") is shadowed by GET /files/* (route \"files\") drawn before it"`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("expected warning %q, got %q", e, out)
+		}
+	}
+	if strings.Contains(out, "preview") {
+		t.Errorf("expected no warning for routes with other methods, got %q", out)
+	}
+}
+
+func TestShadowedRoutes_DefaultLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	d := New()
+	d.WarnShadowedRoutes = true
+	d.Draw(func(r *Scope) {
+		r.Get("/pages/:id").As("page").To(h)
+		r.Get("/pages/search").As("search_pages").To(h)
+	})
+
+	if out := buf.String(); !strings.Contains(out, `WARN route GET /pages/search (route "search_pages") is shadowed by GET /pages/:id (route "page") drawn before it`) {
+		t.Errorf("expected the warning without a Logger, got %q", out)
+	}
+}
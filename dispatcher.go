@@ -1,19 +1,55 @@
 package lazydispatch
 
 import (
+	"context"
+	"log/slog"
 	"net/http"
-	"net/url"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 
 	"golazy.dev/router"
 )
 
 type Dispatcher struct {
-	Routes      []*Route
+	Routes []*Route
+
+	// HandleMethodNotAllowed makes the dispatcher answer 405 Method Not Allowed
+	// with an Allow header when the path exists under other methods.
+	// When false, those requests get a 404 Not Found. It defaults to true.
+	HandleMethodNotAllowed bool
+
+	// WarnShadowedRoutes makes Draw log a warning for every route with a static
+	// segment that is hidden by a :param segment of a route drawn before it.
+	WarnShadowedRoutes bool
+
+	// TrustForwardedProto makes the scheme of the requests come from the Forwarded and
+	// X-Forwarded-Proto headers, for the routes restricted to a scheme and URLFor.
+	// Only set it when the requests come through a proxy that sets those headers.
+	TrustForwardedProto bool
+
 	httpr       *router.Router[Route]
+	origins     []*originRouter // origins have the routes restricted to a scheme, host or port
 	names       *namedRoutes
+	methods     []string // methods is the sorted list of methods used by the drawn routes
 	middlewares []func(http.Handler) http.Handler
+	routed      []func(http.Handler) http.Handler // routed are the middlewares that run after matching
+	named       []middleware
+	served      []*Route // served are the routes added to httpr, including the implicit ones
 	app         func() http.Handler
+
+	notFound            http.Handler
+	methodNotAllowed    http.Handler
+	notAcceptable       http.Handler
+	internalServerError http.Handler
+	providers           map[reflect.Type]provider
+	logger              *slog.Logger
+	instrumenters       []Instrumenter
+	errorHandlers       []ErrorHandlerFunc
+	renderers           []renderer
+	formatList          []formatMIME // formatList are the formats that can be negotiated, set by Draw
 }
 
 func New() *Dispatcher {
@@ -22,10 +58,22 @@ func New() *Dispatcher {
 		names:       newNamedRoutes(),
 		Routes:      make([]*Route, 0),
 		middlewares: make([]func(http.Handler) http.Handler, 0),
+
+		HandleMethodNotAllowed: true,
+		notFound:               defaultNotFound,
+		methodNotAllowed:       defaultMethodNotAllowed,
+		notAcceptable:          defaultNotAcceptable,
+		internalServerError:    defaultInternalServerError,
+		providers:              make(map[reflect.Type]provider),
+		logger:                 discardLogger,
+		renderers:              slices.Clone(defaultRenderers),
 	}
 	d.app = sync.OnceValue(func() http.Handler {
-
 		var handler http.Handler = http.HandlerFunc(d.dispatch)
+		for _, m := range d.routed {
+			handler = m(handler)
+		}
+		handler = d.match(d.recoverer(handler))
 		for _, m := range d.middlewares {
 			handler = m(handler)
 		}
@@ -34,22 +82,105 @@ func New() *Dispatcher {
 	return d
 }
 
+// notAcceptableKey marks the requests whose route can't answer any of the accepted formats
+type notAcceptableKey struct{}
+
+// match finds the route for the request and stores it, its subdomains and the format in the context before calling next.
+// When the route can't answer any of the accepted formats, dispatch serves the NotAcceptable handler instead of the route.
+func (d *Dispatcher) match(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, r, format := d.find(r)
+		if route != nil {
+			ctx := r.Context()
+			if format == "" {
+				var ok bool
+				if format, ok = d.negotiateFormat(route, r); !ok {
+					ctx = context.WithValue(ctx, notAcceptableKey{}, true)
+				}
+			}
+			ctx = context.WithValue(ctx, tRoute, route)
+			if subdomains, ok := route.matchOrigin(r, d.requestScheme(r)); ok && subdomains != nil {
+				ctx = context.WithValue(ctx, subdomainsKey{}, subdomains)
+			}
+			r = r.WithContext(context.WithValue(ctx, formatKey{}, format))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (d *Dispatcher) dispatch(w http.ResponseWriter, r *http.Request) {
-	route := d.httpr.Find(r)
+	route := RouteFrom(r.Context())
 	if route == nil {
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(http.StatusText(http.StatusNotFound)))
+		if d.HandleMethodNotAllowed {
+			if allow := d.allowedMethods(r); len(allow) > 0 {
+				w.Header().Set("Allow", strings.Join(allow, ", "))
+				serveWithStatus(d.methodNotAllowed, http.StatusMethodNotAllowed, w, r)
+				return
+			}
+		}
+		serveWithStatus(d.notFound, http.StatusNotFound, w, r)
+		return
+	}
+	if notAcceptable, _ := r.Context().Value(notAcceptableKey{}).(bool); notAcceptable {
+		serveWithStatus(d.notAcceptable, http.StatusNotAcceptable, w, r)
 		return
 	}
-	route.Handler.ServeHTTP(w, r)
+	route.handler.ServeHTTP(w, r)
+}
+
+// answerOptions answers the implicit OPTIONS routes with the allowed methods
+func (d *Dispatcher) answerOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", strings.Join(d.allowedMethods(r), ", "))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allowedMethods returns the methods that have a route matching the request path.
+// OPTIONS is always included when any other method matches, as the dispatcher answers it.
+func (d *Dispatcher) allowedMethods(r *http.Request) []string {
+	allow := []string{}
+	for _, method := range d.methods {
+		req := *r
+		req.Method = method
+		if route, _, _ := d.find(&req); route != nil {
+			allow = append(allow, method)
+		}
+	}
+	if len(allow) > 0 && !slices.Contains(allow, http.MethodOptions) {
+		allow = append(allow, http.MethodOptions)
+		sort.Strings(allow)
+	}
+	return allow
+}
+
+// addMethods registers the methods of a route definition like "PUT,PATCH"
+func (d *Dispatcher) addMethods(methods string) {
+	for _, method := range strings.Split(methods, ",") {
+		i := sort.SearchStrings(d.methods, method)
+		if i < len(d.methods) && d.methods[i] == method {
+			continue
+		}
+		d.methods = append(d.methods, "")
+		copy(d.methods[i+1:], d.methods[i:])
+		d.methods[i] = method
+	}
 }
 
 // Use adds a middleware to the dispatcher
+// The middlewares run before routing, so they can change the method or the path
+// of the request, but they can't see the matched route.
 // All the middlewares have to be setup before calling ServeHTTP
 func (d *Dispatcher) Use(middleware func(http.Handler) http.Handler) {
 	d.middlewares = append(d.middlewares, middleware)
 }
 
+// UseRouted adds a middleware that runs after the request is matched.
+// The matched route is available with RouteFrom(r.Context()). It is nil when
+// no route matched and the request is going to the not found handler.
+// All the middlewares have to be setup before calling ServeHTTP
+func (d *Dispatcher) UseRouted(middleware func(http.Handler) http.Handler) {
+	d.routed = append(d.routed, middleware)
+}
+
 func (d *Dispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	d.app().ServeHTTP(w, r)
 }
@@ -59,36 +190,57 @@ func (d *Dispatcher) PathFor(args ...any) string {
 }
 
 func (d *Dispatcher) Draw(fn func(r *Scope)) *Scope {
+	d.formatList = d.formats()
 	drawer := newScope()
+	drawer.variantFormats = d.formatList
 	fn(drawer)
 	d.Routes = drawer.routes()
 	for _, route := range d.Routes {
-
 		route.normalize()
+	}
+	d.checkRoutes(d.Routes)
+	d.checkActions(d.Routes)
+	d.checkFallbacks()
+	if err := d.checkNamed(d.Routes); err != nil {
+		panic(err)
+	}
+
+	for _, route := range d.Routes {
 		// Add route
 		if route.Handler != nil {
-			d.httpr.Add(&router.RouteDefinition{
-				Method: route.Method,
-				Path:   route.URL,
-			}, route)
+			route.handler = d.handlerFor(route)
+			d.served = append(d.served, route)
+			d.add(route)
+			d.addMethods(route.Method)
 		}
 
 		// Add name
 		if route.Name != "" {
-			u, err := url.Parse(route.URL)
-			if err != nil {
-				panic(err)
-			}
-
 			d.names.Add(Route{
-				Path:   u.Path,
-				Name:   route.Name,
-				Models: route.Models,
+				Path:      route.Path,
+				Name:      route.Name,
+				Models:    route.Models,
+				Scheme:    route.Scheme,
+				Subdomain: route.Subdomain,
+				Host:      route.Host,
+				Port:      route.Port,
 			})
 		}
 	}
 
-	// Add to names
+	// Add implicit HEAD and OPTIONS routes
+	implicit := implicitHeadRoutes(d.Routes)
+	for _, route := range implicitOptionsRoutes(d.Routes) {
+		route.Handler = http.HandlerFunc(d.answerOptions)
+		implicit = append(implicit, route)
+	}
+	for _, route := range implicit {
+		route.handler = d.handlerFor(route)
+		d.served = append(d.served, route)
+		d.add(route)
+		d.addMethods(route.Method)
+	}
+
 	return drawer
 
 }
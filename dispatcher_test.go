@@ -88,3 +88,30 @@ func ExampleDispatcher_Draw() {
 	// /pages	PagesController#Index	pages
 	// /pages/:page_id	PagesController#Show	page
 }
+
+func TestDispatcher_MethodNotAllowed(t *testing.T) {
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Resources(&PostsController{})
+	})
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("DELETE", "/posts", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected code %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS, POST" {
+		t.Errorf("expected Allow header %q, got %q", "GET, HEAD, OPTIONS, POST", allow)
+	}
+
+	w = httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("POST", "/posts/3", nil))
+	if allow := w.Header().Get("Allow"); allow != "DELETE, GET, HEAD, OPTIONS, PATCH, PUT" {
+		t.Errorf("expected Allow header %q, got %q", "DELETE, GET, HEAD, OPTIONS, PATCH, PUT", allow)
+	}
+
+	expect2(t, d, "GET", "/unknown", nil, http.StatusNotFound, "Not Found")
+
+	d.HandleMethodNotAllowed = false
+	expect2(t, d, "DELETE", "/posts", nil, http.StatusNotFound, "Not Found")
+}
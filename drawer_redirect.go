@@ -27,6 +27,7 @@ func (redirect *redirect) routes() []*Route {
 
 	r := &Route{}
 	r.Method, r.URL, r.Name, _, r.Models = redirect.scope.routeInfo()
+	redirect.scope.apply(r)
 	r.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, redirect.to, redirect.code)
 	})
@@ -1,7 +1,6 @@
 package lazydispatch
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -18,7 +17,7 @@ func (s *Scope) Resource(controller any) *Resource {
 
 func newResource(s *Scope, controller any) *Resource {
 	r := &Resource{
-		parentScope: s,
+		parentScope: s.newChild(), // holds the middlewares of the resource
 		Controller:  controller,
 	}
 	validateResource(r)
@@ -53,6 +52,30 @@ func (r *Resource) Path(path string) *Resource {
 	r.path = path
 	return r
 }
+
+// Use adds middlewares to all the routes of the resource, including the nested ones
+func (r *Resource) Use(middlewares ...func(http.Handler) http.Handler) *Resource {
+	r.parentScope.Use(middlewares...)
+	return r
+}
+
+// SkipMiddleware disables named middlewares for all the routes of the resource. See Scope.SkipMiddleware
+func (r *Resource) SkipMiddleware(names ...string) *Resource {
+	r.parentScope.SkipMiddleware(names...)
+	return r
+}
+
+// OnlyMiddleware restricts the named middlewares for all the routes of the resource. See Scope.OnlyMiddleware
+func (r *Resource) OnlyMiddleware(names ...string) *Resource {
+	r.parentScope.OnlyMiddleware(names...)
+	return r
+}
+
+// Formats restricts the formats of all the routes of the resource. See Scope.Formats
+func (r *Resource) Formats(formats ...Format) *Resource {
+	r.parentScope.Formats(formats...)
+	return r
+}
 func (r *Resource) actionScope(name string) (*Scope, string) {
 	scope := r.parentScope.newChild()
 	scope.method = "GET"
@@ -96,7 +119,7 @@ func (r *Resource) routeForAction(name string) *Route {
 	if scope == nil {
 		return nil
 	}
-	method, path, name, _, models := scope.routeInfo()
+	method, path, name, namespace, models := scope.routeInfo()
 
 	route := &Route{
 		Method: method,
@@ -105,11 +128,12 @@ func (r *Resource) routeForAction(name string) *Route {
 		Action: actionName,
 		Models: models,
 		Target: fmt.Sprintf("%s#%s", r.controllerFullName, originalName),
+
+		Controller: r.controllerFullName,
+		Namespace:  namespace,
 	}
-	route.Handler = forAction(r.Controller, originalName, func(ctx context.Context, req *http.Request) context.Context {
-		c := context.WithValue(ctx, reflect.TypeOf(route), route)
-		return c
-	})
+	scope.apply(route)
+	route.Handler = newAction(r.Controller, originalName, r.parentScope.top().variantFormats)
 	return route
 
 }
@@ -130,9 +154,8 @@ func (r *Resource) routes() []*Route {
 	validateResource(r)
 
 	routes := []*Route{}
-	t := reflect.TypeOf(r.Controller)
-	for i := 0; i < t.NumMethod(); i++ {
-		route := r.routeForAction(t.Method(i).Name)
+	for _, name := range actionNames(methodNames(r.Controller), r.parentScope.top().variantFormats) {
+		route := r.routeForAction(name)
 		if route == nil {
 			continue
 		}
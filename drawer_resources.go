@@ -1,7 +1,6 @@
 package lazydispatch
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -101,6 +100,30 @@ func (r *Resources) Namespace(n string) *Resources {
 	return r
 }
 
+// Use adds middlewares to all the routes of the resources, including the nested ones
+func (r *Resources) Use(middlewares ...func(http.Handler) http.Handler) *Resources {
+	r.scope.Use(middlewares...)
+	return r
+}
+
+// SkipMiddleware disables named middlewares for all the routes of the resources. See Scope.SkipMiddleware
+func (r *Resources) SkipMiddleware(names ...string) *Resources {
+	r.scope.SkipMiddleware(names...)
+	return r
+}
+
+// OnlyMiddleware restricts the named middlewares for all the routes of the resources. See Scope.OnlyMiddleware
+func (r *Resources) OnlyMiddleware(names ...string) *Resources {
+	r.scope.OnlyMiddleware(names...)
+	return r
+}
+
+// Formats restricts the formats of all the routes of the resources. See Scope.Formats
+func (r *Resources) Formats(formats ...Format) *Resources {
+	r.scope.Formats(formats...)
+	return r
+}
+
 // Record
 type Resources struct {
 	scope *Scope
@@ -118,7 +141,9 @@ type Resources struct {
 
 	model any
 
+	// Scheme, Domain and Port restrict the routes of the resources to a host. See Host
 	Scheme, Domain, Port string
+	subdomain            string
 
 	controllerFullName string
 	controllerName     string
@@ -130,6 +155,7 @@ func (r *Resources) newScope() *Scope {
 	s.as = r.singular
 	s.namespace = r.namespace
 	s.model = r.model
+	s.scheme, s.subdomain, s.host, s.port = r.Scheme, r.subdomain, r.Domain, r.Port
 	return s
 }
 
@@ -142,9 +168,8 @@ func (r *Resources) routes() []*Route {
 	validateResources(r)
 	routes := []*Route{}
 
-	t := reflect.TypeOf(r.Controller)
-	for i := 0; i < t.NumMethod(); i++ {
-		route := r.routeForAction(t.Method(i).Name)
+	for _, name := range actionNames(methodNames(r.Controller), r.scope.top().variantFormats) {
+		route := r.routeForAction(name)
 		if route == nil {
 			continue
 		}
@@ -259,7 +284,7 @@ func (r Resources) routeForAction(name string) *Route {
 	if scope == nil {
 		return nil
 	}
-	method, path, name, _, models := scope.routeInfo()
+	method, path, name, namespace, models := scope.routeInfo()
 
 	route := &Route{
 		Method: method,
@@ -268,11 +293,13 @@ func (r Resources) routeForAction(name string) *Route {
 		Models: models,
 		Action: actionName,
 		Target: fmt.Sprintf("%s#%s", r.controllerFullName, originalName),
+
+		Controller: r.controllerFullName,
+		Namespace:  namespace,
 	}
-	route.Handler = forAction(r.Controller, originalName, func(ctx context.Context, req *http.Request) context.Context {
-		c := context.WithValue(ctx, reflect.TypeOf(route), route)
-		return c
-	})
+	scope.apply(route)
+	route.restrict(r.Scheme, r.subdomain, r.Domain, r.Port, true)
+	route.Handler = newAction(r.Controller, originalName, r.scope.top().variantFormats)
 	return route
 }
 
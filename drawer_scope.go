@@ -2,6 +2,7 @@ package lazydispatch
 
 import (
 	"fmt"
+	"net/http"
 )
 
 type routeGen interface {
@@ -21,6 +22,15 @@ type Scope struct {
 	model     any
 	verb      string
 	namespace string
+
+	middlewares []func(http.Handler) http.Handler
+	skip        []string
+	only        []string
+	formats     []Format
+
+	scheme, subdomain, host, port string
+
+	variantFormats []formatMIME // variantFormats are the formats of the dispatcher, set in the top scope by Draw
 }
 
 func (s *Scope) clone() *Scope {
@@ -87,6 +97,9 @@ func (s *Scope) Delete(path string) *Scope {
 func (s *Scope) Options(path string) *Scope {
 	return s.newMethod("OPTIONS").Path(path)
 }
+func (s *Scope) Head(path string) *Scope {
+	return s.newMethod("HEAD").Path(path)
+}
 
 func (s *Scope) Namespace(n string) *Scope {
 	s = s.newChild()
@@ -94,6 +107,62 @@ func (s *Scope) Namespace(n string) *Scope {
 	return s
 }
 
+// Use adds middlewares to all the routes drawn in the scope and its children.
+// They run after the route is matched, inside the middlewares of the parent scopes.
+//
+//	r.Namespace("admin").Draw(func(admin *Scope) {
+//		admin.Use(RequireAdmin)
+//		admin.Resources(&UsersController{})
+//	})
+func (s *Scope) Use(middlewares ...func(http.Handler) http.Handler) *Scope {
+	s.middlewares = append(s.middlewares, middlewares...)
+	return s
+}
+
+// SkipMiddleware disables the named middlewares registered with Dispatcher.UseNamed
+// for the routes drawn in the scope and its children
+func (s *Scope) SkipMiddleware(names ...string) *Scope {
+	s.skip = append(s.skip, names...)
+	return s
+}
+
+// OnlyMiddleware makes the routes drawn in the scope and its children run only the given
+// named middlewares. An OnlyMiddleware in a child scope replaces the one of its parents.
+func (s *Scope) OnlyMiddleware(names ...string) *Scope {
+	s.only = append(s.only, names...)
+	if s.only == nil {
+		s.only = []string{}
+	}
+	return s
+}
+
+// Formats restricts the formats of the routes drawn in the scope and its children.
+// The first one is used when the client has no preference. Formats in a child scope replace the ones of its parents.
+//
+//	r.Path("api").Formats("json").Draw(func(api *Scope) {
+//		...
+//	})
+func (s *Scope) Formats(formats ...Format) *Scope {
+	s.formats = append(s.formats, formats...)
+	return s
+}
+
+// apply records in the route the middlewares, outermost first, and the formats and host of the scope and its parents
+func (s *Scope) apply(r *Route) {
+	r.Middlewares, r.SkipMiddlewares, r.OnlyMiddlewares, r.Formats = nil, nil, nil, nil
+	for ; s != nil; s = s.parent {
+		r.restrict(s.scheme, s.subdomain, s.host, s.port, false)
+		if r.Formats == nil && s.formats != nil {
+			r.Formats = append([]Format{}, s.formats...)
+		}
+		r.Middlewares = append(append([]func(http.Handler) http.Handler{}, s.middlewares...), r.Middlewares...)
+		r.SkipMiddlewares = append(r.SkipMiddlewares, s.skip...)
+		if r.OnlyMiddlewares == nil && s.only != nil {
+			r.OnlyMiddlewares = append([]string{}, s.only...)
+		}
+	}
+}
+
 func (s *Scope) Draw(fn func(s *Scope)) *Scope {
 	s = s.newChild()
 	fn(s)
@@ -1,6 +1,10 @@
 package lazydispatch
 
-import "testing"
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
 
 func TestScope(t *testing.T) {
 
@@ -31,3 +35,87 @@ func TestScope(t *testing.T) {
 	expect(&Scope{parent: parent, method: "PUT", path: "fritas", as: "weapon", namespace: "super"}, "PUT", "/patatas/fritas", "secret_weapon", "admin/super")
 
 }
+
+// tag returns a middleware that appends name to the X-Chain header
+func tag(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Chain", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func TestScope_Use(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Get("/public").To(ok)
+		r.Namespace("admin").Path("admin").Draw(func(admin *Scope) {
+			admin.Get("dashboard").To(ok)
+			admin.Use(requireAuth)
+			admin.Resources(&PagesController{}).Path("pages")
+		})
+		r.Path("api").Use(tag("api")).Draw(func(api *Scope) {
+			api.Get("status").To(ok)
+			api.Resources(&PagesController{}).Path("pages").Use(tag("pages"))
+			api.Resource(&SessionController{}).Use(tag("session"))
+		})
+	})
+
+	expect2(t, d, "GET", "/public", nil, http.StatusOK, "ok")
+	expect2(t, d, "GET", "/admin/dashboard", nil, http.StatusUnauthorized, "unauthorized\n")
+	expect2(t, d, "GET", "/admin/pages", nil, http.StatusUnauthorized, "unauthorized\n")
+	expect2(t, d, "HEAD", "/admin/pages", nil, http.StatusUnauthorized, "")
+
+	chain := func(path string) []string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected code %d, got %d", path, http.StatusOK, w.Code)
+		}
+		return w.Header().Values("X-Chain")
+	}
+	tests := map[string][]string{
+		"/public":      nil,
+		"/api/status":  {"api"},
+		"/api/pages":   {"api", "pages"},
+		"/api/pages/1": {"api", "pages"},
+		"/api/session": {"api", "session"},
+	}
+	for path, expected := range tests {
+		got := chain(path)
+		if len(got) != len(expected) {
+			t.Errorf("%s: expected chain %v, got %v", path, expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != expected[i] {
+				t.Errorf("%s: expected chain %v, got %v", path, expected, got)
+			}
+		}
+	}
+
+	for _, route := range d.Routes {
+		if route.Path == "/api/pages/:page_id" && len(route.Middlewares) != 2 {
+			t.Errorf("expected the route to record 2 middlewares, got %d", len(route.Middlewares))
+		}
+		if route.Path == "/public" && len(route.Middlewares) != 0 {
+			t.Errorf("expected the route to record no middlewares, got %d", len(route.Middlewares))
+		}
+	}
+}
@@ -31,6 +31,7 @@ func (t *toSuper) routes() []*Route {
 	s := t.scope.newChild()
 	s.as = t.as
 	r.Method, r.URL, r.Name, _, r.Models = s.routeInfo()
+	s.apply(r)
 
 	r.normalize()
 
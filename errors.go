@@ -0,0 +1,140 @@
+package lazydispatch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// HTTPError is an error that knows the status code of the response.
+// When a controller without HandleError returns one, the Dispatcher answers with its status.
+type HTTPError interface {
+	error
+	StatusCode() int
+}
+
+// statusError adds a status code to an error
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	if e.err == nil {
+		return http.StatusText(e.status)
+	}
+	return e.err.Error()
+}
+
+func (e *statusError) StatusCode() int {
+	return e.status
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+// WithStatus returns an HTTPError with the given status that wraps err. err can be nil.
+//
+//	if errors.Is(err, sql.ErrNoRows) {
+//		return lazydispatch.WithStatus(http.StatusNotFound, err)
+//	}
+func WithStatus(status int, err error) error {
+	return &statusError{status: status, err: err}
+}
+
+// BadRequest wraps err as a 400 Bad Request error
+func BadRequest(err error) error {
+	return WithStatus(http.StatusBadRequest, err)
+}
+
+// Unauthorized wraps err as a 401 Unauthorized error
+func Unauthorized(err error) error {
+	return WithStatus(http.StatusUnauthorized, err)
+}
+
+// Forbidden wraps err as a 403 Forbidden error
+func Forbidden(err error) error {
+	return WithStatus(http.StatusForbidden, err)
+}
+
+// NotFound wraps err as a 404 Not Found error
+func NotFound(err error) error {
+	return WithStatus(http.StatusNotFound, err)
+}
+
+// Conflict wraps err as a 409 Conflict error
+func Conflict(err error) error {
+	return WithStatus(http.StatusConflict, err)
+}
+
+// UnprocessableEntity wraps err as a 422 Unprocessable Entity error
+func UnprocessableEntity(err error) error {
+	return WithStatus(http.StatusUnprocessableEntity, err)
+}
+
+// StatusCode returns the status code of the first HTTPError in the chain of err,
+// or 500 Internal Server Error if there is none.
+func StatusCode(err error) int {
+	var herr HTTPError
+	if errors.As(err, &herr) {
+		return herr.StatusCode()
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrorHandlerFunc handles an error that a controller couldn't handle by itself.
+// It returns false to let the next handler try.
+type ErrorHandlerFunc func(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) bool
+
+// OnError adds a handler for the errors of all the controllers. The handlers are tried in the
+// order they are added when a controller without HandleError fails, or a handler panics.
+// If none of them handles the error, the InternalServerError handler is used, or the NotFound,
+// MethodNotAllowed and NotAcceptable ones for 404, 405 and 406 errors.
+// If a handler writes nothing, the response status is the StatusCode of the error.
+//
+//	d.OnError(lazydispatch.ErrorIs(sql.ErrNoRows, func(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) bool {
+//		http.Error(w, "not found", http.StatusNotFound)
+//		return true
+//	}))
+//
+// They have to be added before calling Draw.
+func (d *Dispatcher) OnError(h ErrorHandlerFunc) {
+	d.errorHandlers = append(d.errorHandlers, h)
+}
+
+// ErrorIs returns an ErrorHandlerFunc that calls h only for errors that match target with errors.Is
+func ErrorIs(target error, h ErrorHandlerFunc) ErrorHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) bool {
+		return errors.Is(err, target) && h(ctx, w, r, err)
+	}
+}
+
+// ErrorAs returns an ErrorHandlerFunc that calls h only for errors that have a T in their chain,
+// found with errors.As
+//
+//	d.OnError(lazydispatch.ErrorAs(func(ctx context.Context, w http.ResponseWriter, r *http.Request, err *ValidationError) bool {
+//		w.WriteHeader(http.StatusUnprocessableEntity)
+//		json.NewEncoder(w).Encode(err.Fields)
+//		return true
+//	}))
+func ErrorAs[T error](h func(ctx context.Context, w http.ResponseWriter, r *http.Request, err T) bool) ErrorHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) bool {
+		var target T
+		return errors.As(err, &target) && h(ctx, w, r, target)
+	}
+}
+
+// handleError tries the handlers in order until one handles err
+func handleError(handlers []ErrorHandlerFunc, w http.ResponseWriter, r *http.Request, err error) bool {
+	for _, h := range handlers {
+		sw := &statusWriter{ResponseWriter: w, status: StatusCode(err)}
+		if h(r.Context(), sw, r, err) {
+			if !sw.wroteHeader {
+				sw.WriteHeader(sw.status)
+			}
+			return true
+		}
+	}
+	return false
+}
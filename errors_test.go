@@ -0,0 +1,145 @@
+package lazydispatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+var errNoRows = errors.New("no rows")
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{nil, http.StatusInternalServerError},
+		{errNoRows, http.StatusInternalServerError},
+		{NotFound(errNoRows), http.StatusNotFound},
+		{fmt.Errorf("finding post: %w", NotFound(errNoRows)), http.StatusNotFound},
+		{UnprocessableEntity(nil), http.StatusUnprocessableEntity},
+		{BadRequest(nil), http.StatusBadRequest},
+		{Unauthorized(nil), http.StatusUnauthorized},
+		{Forbidden(nil), http.StatusForbidden},
+		{Conflict(nil), http.StatusConflict},
+		{WithStatus(http.StatusTeapot, nil), http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		if got := StatusCode(tt.err); got != tt.status {
+			t.Errorf("%v: expected status %d, got %d", tt.err, tt.status, got)
+		}
+	}
+
+	err := fmt.Errorf("finding post: %w", NotFound(errNoRows))
+	if !errors.Is(err, errNoRows) {
+		t.Error("expected the wrapped error to be found")
+	}
+	var herr HTTPError
+	if !errors.As(err, &herr) || herr.Error() != "no rows" {
+		t.Errorf("expected an HTTPError, got %v", herr)
+	}
+	if UnprocessableEntity(nil).Error() != "Unprocessable Entity" {
+		t.Errorf("unexpected message %q", UnprocessableEntity(nil).Error())
+	}
+}
+
+type ArticlesController struct{}
+
+func (c *ArticlesController) Index() error {
+	return fmt.Errorf("listing: %w", Forbidden(nil))
+}
+
+func (c *ArticlesController) Show(id string) (string, error) {
+	if id != "1" {
+		return "", NotFound(errNoRows)
+	}
+	return "article 1", nil
+}
+
+func (c *ArticlesController) Create() error {
+	return UnprocessableEntity(errors.New("title is required"))
+}
+
+func TestDispatcher_HTTPErrors(t *testing.T) {
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Resources(&ArticlesController{}).Path("articles")
+	})
+
+	expect2(t, d, "GET", "/articles", nil, http.StatusForbidden, "Forbidden")
+	expect2(t, d, "GET", "/articles/1", nil, http.StatusOK, "article 1")
+	expect2(t, d, "GET", "/articles/2", nil, http.StatusNotFound, "Not Found")
+	expect2(t, d, "POST", "/articles", nil, http.StatusUnprocessableEntity, "Unprocessable Entity")
+}
+
+type ValidationError struct {
+	Field string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Field + " is invalid"
+}
+
+type CommentsController struct{}
+
+func (c *CommentsController) Index() error {
+	return fmt.Errorf("loading comments: %w", errNoRows)
+}
+
+func (c *CommentsController) Create() error {
+	return &ValidationError{Field: "body"}
+}
+
+func (c *CommentsController) Delete(id string) error {
+	return errors.New("locked")
+}
+
+func TestDispatcher_OnError(t *testing.T) {
+	calls := []string{}
+	d := New()
+	d.OnError(func(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) bool {
+		calls = append(calls, "all")
+		return false
+	})
+	d.OnError(ErrorIs(errNoRows, func(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) bool {
+		w.Write([]byte("nothing here"))
+		return true
+	}))
+	d.OnError(ErrorAs(func(ctx context.Context, w http.ResponseWriter, r *http.Request, err *ValidationError) bool {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(err.Field))
+		return true
+	}))
+	d.Draw(func(r *Scope) {
+		r.Resources(&CommentsController{}).Path("comments")
+		r.Get("broken").To(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(NotFound(errNoRows))
+		}))
+	})
+
+	// Unhandled errors default to the status code of the error
+	expect2(t, d, "GET", "/comments", nil, http.StatusInternalServerError, "nothing here")
+	expect2(t, d, "POST", "/comments", nil, http.StatusUnprocessableEntity, "body")
+	expect2(t, d, "DELETE", "/comments/1", nil, http.StatusInternalServerError, "Internal Server Error")
+	expect2(t, d, "GET", "/broken", nil, http.StatusNotFound, "nothing here")
+	if len(calls) != 4 {
+		t.Errorf("expected the handlers to be called once per error, got %v", calls)
+	}
+
+	// The HandleError of the controller goes first
+	calls = nil
+	d2 := New()
+	d2.OnError(func(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) bool {
+		calls = append(calls, "all")
+		return true
+	})
+	d2.Draw(func(r *Scope) {
+		r.Get("panics").To(forAction(&PanicController{action: errNoRows}, "Index"))
+	})
+	expect2(t, d2, "GET", "/panics", nil, 503, "panic: no rows")
+	if len(calls) != 0 {
+		t.Errorf("expected the controller to handle the error, got %v", calls)
+	}
+}
@@ -0,0 +1,84 @@
+package lazydispatch
+
+import (
+	"net/http"
+)
+
+// NotFound sets the handler used when no route matches the request, or a handler fails with a 404 error.
+// The response status defaults to 404 unless the handler writes its own.
+//
+//	d.NotFound(lazydispatch.Action(&ErrorsController{}, "NotFound"))
+func (d *Dispatcher) NotFound(h http.Handler) {
+	d.notFound = h
+}
+
+// MethodNotAllowed sets the handler used when the path exists under other methods, or a handler
+// fails with a 405 error. In the first case the Allow header is already set when the handler is called.
+// The response status defaults to 405 unless the handler writes its own.
+func (d *Dispatcher) MethodNotAllowed(h http.Handler) {
+	d.methodNotAllowed = h
+}
+
+// NotAcceptable sets the handler used when the route can't answer any of the formats of the
+// Accept header, or an action has no variant for the format of the request.
+// The response status defaults to 406 unless the handler writes its own.
+func (d *Dispatcher) NotAcceptable(h http.Handler) {
+	d.notAcceptable = h
+}
+
+// InternalServerError sets the handler used when a matched handler panics, or a controller without
+// HandleError returns an error, before writing the response. The 404, 405 and 406 errors go to the
+// NotFound, MethodNotAllowed and NotAcceptable handlers instead.
+// The error is available with ErrorFrom(r.Context()) and the response status defaults to its
+// StatusCode, 500 unless it is an HTTPError, unless the handler writes its own.
+func (d *Dispatcher) InternalServerError(h http.Handler) {
+	d.internalServerError = h
+}
+
+var defaultNotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte(http.StatusText(http.StatusNotFound)))
+})
+
+var defaultInternalServerError = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	status := StatusCode(ErrorFrom(r.Context()))
+	w.WriteHeader(status)
+	w.Write([]byte(http.StatusText(status)))
+})
+
+var defaultMethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	w.Write([]byte(http.StatusText(http.StatusMethodNotAllowed)))
+})
+
+// statusWriter writes status instead of 200 when the handler does not set one
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(w.status)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// serveWithStatus serves h with status as the default response status
+func serveWithStatus(h http.Handler, status int, w http.ResponseWriter, r *http.Request) {
+	sw := &statusWriter{ResponseWriter: w, status: status}
+	h.ServeHTTP(sw, r)
+	if !sw.wroteHeader {
+		sw.WriteHeader(status)
+	}
+}
@@ -0,0 +1,129 @@
+package lazydispatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type ErrorsController struct {
+	BaseController
+}
+
+func (c *ErrorsController) NotFound(r *http.Request) {
+	c.out = "nothing at " + r.URL.Path
+}
+
+func TestDispatcher_NotFound(t *testing.T) {
+	d := New()
+	d.NotFound(Action(&ErrorsController{}, "NotFound"))
+	d.MethodNotAllowed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not allowed: " + ErrorFrom(r.Context()).Error()))
+	}))
+	d.Draw(func(r *Scope) {
+		r.Resources(&PostsController{})
+		r.Resources(&ArticlesController{}).Path("articles")
+		r.Get("locked").To(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(WithStatus(http.StatusMethodNotAllowed, errors.New("locked")))
+		}))
+	})
+
+	expect2(t, d, "GET", "/unknown", nil, http.StatusNotFound, "nothing at /unknown")
+	expect2(t, d, "GET", "/posts", nil, http.StatusOK, "index")
+	// The 404 and 405 errors of the handlers use the same pages
+	expect2(t, d, "GET", "/articles/2", nil, http.StatusNotFound, "nothing at /articles/2")
+	expect2(t, d, "GET", "/locked", nil, http.StatusMethodNotAllowed, "not allowed: locked")
+}
+
+func TestDispatcher_MethodNotAllowed_Handler(t *testing.T) {
+	d := New()
+	d.MethodNotAllowed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.Write([]byte(`{"allow":"` + w.Header().Get("Allow") + `"}`))
+	}))
+	d.Draw(func(r *Scope) {
+		r.Resources(&PostsController{})
+	})
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("DELETE", "/posts", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected code %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+	if body := w.Body.String(); body != `{"allow":"GET, HEAD, OPTIONS, POST"}` {
+		t.Errorf("unexpected body %q", body)
+	}
+}
+
+func TestDispatcher_NotAcceptable(t *testing.T) {
+	d := New()
+	d.NotAcceptable(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("only html and json for " + RouteFrom(r.Context()).Target))
+	}))
+	d.UseRouted(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Route", RouteFrom(r.Context()).Name)
+			next.ServeHTTP(w, r)
+		})
+	})
+	d.Draw(func(r *Scope) {
+		r.Resources(&InvoicesController{}).Path("invoices")
+	})
+
+	r := httptest.NewRequest("GET", "/invoices", nil)
+	r.Header.Set("Accept", "application/xml")
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, r)
+	if w.Code != http.StatusNotAcceptable || w.Body.String() != "only html and json for InvoicesController#Index" {
+		t.Errorf("expected 406 from the handler, got %d %q", w.Code, w.Body.String())
+	}
+	if route := w.Header().Get("X-Route"); route != "invoices" {
+		t.Errorf("expected the routed middlewares to run for route %q, got %q", "invoices", route)
+	}
+
+	route := d.served[0]
+	r = httptest.NewRequest("GET", "/invoices", nil)
+	r = r.WithContext(context.WithValue(context.WithValue(r.Context(), tRoute, route), formatKey{}, Format("xml")))
+	w = httptest.NewRecorder()
+	route.Handler.ServeHTTP(w, r)
+	if w.Code != http.StatusNotAcceptable || !strings.HasPrefix(w.Body.String(), "only html and json") {
+		t.Errorf("expected the action to use the handler, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+type FallbackController struct{}
+
+func (c *FallbackController) Missing(account *Account) string {
+	return "nothing here for " + account.Name
+}
+
+func (c *FallbackController) Unresolvable(invoice *Invoice) string {
+	return "invoice " + invoice.ID
+}
+
+func TestDispatcher_FallbackActions(t *testing.T) {
+	d := New()
+	d.Provide(func(r *http.Request) *Account {
+		return &Account{Name: r.URL.Query().Get("name")}
+	})
+	d.NotFound(Action(&FallbackController{}, "Missing"))
+	d.Draw(func(r *Scope) {
+		r.Resources(&PostsController{})
+	})
+	expect2(t, d, "GET", "/unknown?name=golazy", nil, http.StatusNotFound, "nothing here for golazy")
+
+	defer func() {
+		if err := recover(); err == nil || !strings.Contains(fmt.Sprint(err), "InternalServerError handler: ") {
+			t.Errorf("expected Draw to check the parameters of the fallback actions, got %v", err)
+		}
+	}()
+	d = New()
+	d.InternalServerError(Action(&FallbackController{}, "Unresolvable"))
+	d.Draw(func(r *Scope) {
+		r.Resources(&PostsController{})
+	})
+}
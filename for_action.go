@@ -17,13 +17,34 @@ type methodInfo struct {
 	name   string
 	nIn    int
 	nOut   int
+	inputs []inputPlan
 }
 
 func genMethodInfo(m reflect.Method) methodInfo {
 	return methodInfo{method: m.Index, name: m.Name, nIn: m.Type.NumIn(), nOut: m.Type.NumOut()}
 }
 
+// Action returns an http.Handler that runs the action of the controller
+// with all its filters and generators, the same way a drawn route does.
+// It is useful to serve handlers that are not routes, like Dispatcher.NotFound
+//
+//	d.NotFound(lazydispatch.Action(&ErrorsController{}, "NotFound"))
+//
+// Draw gives the providers, OnError handlers, renderers, logger and instrumenters of the
+// Dispatcher to the actions of the routes and of the NotFound, MethodNotAllowed, NotAcceptable
+// and InternalServerError handlers, and checks their parameters. Those handlers have to be set
+// before calling Draw.
+func Action(controller any, action string) http.Handler {
+	return forAction(controller, action)
+}
+
 func forAction[T any](controller T, action string, ctxfn ...func(ctx context.Context, r *http.Request) context.Context) http.Handler {
+	return newAction(controller, action, nil, ctxfn...)
+}
+
+// newAction creates the handler of the action. Its variants are the methods with a suffix
+// in formats, or in the known formats if formats is nil.
+func newAction(controller any, action string, formats []formatMIME, ctxfn ...func(ctx context.Context, r *http.Request) context.Context) *actionctx {
 	// Validate input
 	tt := reflect.TypeOf(controller)
 	if tt.Kind() != reflect.Ptr {
@@ -38,11 +59,12 @@ func forAction[T any](controller T, action string, ctxfn ...func(ctx context.Con
 	actx := &actionctx{}
 	actx.befores = make([]methodInfo, 0)
 	actx.afters = make([]methodInfo, 0)
-	actx.generators = make(map[string]methodInfo)
+	actx.generators = make(map[string]*methodInfo)
 	actx.t = reflect.TypeOf(controller)
 	actx.tt = tt
 	actx.vv = vv
 	actx.ctxfn = ctxfn
+	actx.logger = discardLogger
 
 	// Setup instance pool
 	actx.pool = sync.Pool{
@@ -53,12 +75,27 @@ func forAction[T any](controller T, action string, ctxfn ...func(ctx context.Con
 		},
 	}
 
-	// Fill action
+	// Fill action and its variants by format, like Show_JSON
+	for i := 0; i < actx.t.NumMethod(); i++ {
+		m := actx.t.Method(i)
+		if name, format, ok := splitVariant(m.Name, formats); ok && name == action {
+			actx.variants = append(actx.variants, variant{format: format, mi: genMethodInfo(m)})
+		}
+	}
+	sort.SliceStable(actx.variants, func(i, j int) bool {
+		return formatRank(actx.variants[i].format) < formatRank(actx.variants[j].format)
+	})
+	actx.name = action
 	actionm, ok := actx.t.MethodByName(action)
-	if !ok {
+	switch {
+	case ok:
+		actx.action = genMethodInfo(actionm)
+	case len(actx.variants) > 0:
+		actx.action = actx.variants[0].mi
+		actx.onlyVariants = true
+	default:
 		panic(fmt.Sprintf("action %s not found in controller %s", action, actx.t.String()))
 	}
-	actx.action = genMethodInfo(actionm)
 
 	// Fill generators and filters
 	m := actx.t.NumMethod()
@@ -77,10 +114,32 @@ func forAction[T any](controller T, action string, ctxfn ...func(ctx context.Con
 				panic(fmt.Sprintf("Gen functions must return 1 or 2 values: %s", mi.name))
 			}
 
-			actx.generators[genType(m)] = mi
+			actx.generators[genType(m)] = &mi
 		}
 	}
 
+	// Plan how the inputs of each method are filled
+	plan := func(mi *methodInfo) {
+		m := actx.t.Method(mi.method)
+		mi.inputs = planInputs(actx, m)
+	}
+	for i := range actx.befores {
+		plan(&actx.befores[i])
+	}
+	for i := range actx.afters {
+		plan(&actx.afters[i])
+	}
+	for _, mi := range actx.generators {
+		plan(mi)
+	}
+	if actx.ErrorHandler != nil {
+		plan(actx.ErrorHandler)
+	}
+	plan(&actx.action)
+	for i := range actx.variants {
+		plan(&actx.variants[i].mi)
+	}
+
 	// order filters
 	sort.Slice(actx.befores, func(i, j int) bool {
 		return actx.befores[i].name < actx.befores[j].name
@@ -245,7 +245,6 @@ func (c *PanicController) After_Action() {
 }
 
 func TestForAction_Panics(t *testing.T) {
-	t.Skip("FIX")
 	err := fmt.Errorf("pe")
 	var tests = []struct {
 		name    string
@@ -325,3 +324,34 @@ func TestGeneratorIsCalledOnlyOnce(t *testing.T) {
 	}
 
 }
+
+type BenchController struct {
+	BaseController
+}
+
+func (c *BenchController) Gen_Account(r *http.Request) *Account {
+	return &Account{Name: "bench"}
+}
+
+func (c *BenchController) Show(w http.ResponseWriter, r *http.Request, a *Account, id string) string {
+	return a.Name + id
+}
+
+func BenchmarkForAction(b *testing.B) {
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Resources(&BenchController{}).Path("benchmarks")
+	})
+	r := httptest.NewRequest("GET", "/benchmarks/33", nil)
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, r)
+	if w.Body.String() != "bench33" {
+		b.Fatalf("expected bench33, got %q", w.Body.String())
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
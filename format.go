@@ -0,0 +1,195 @@
+package lazydispatch
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/timewasted/go-accept-headers"
+)
+
+// Format is the format of the response, like "html" or "json".
+// It comes from the extension of the path (/posts/1.json) or, when there is none, from the
+// Accept header. It is empty when the client has no preference.
+// Actions can ask for it as a parameter:
+//
+//	func (c *PostsController) Show(format lazydispatch.Format, id string) string
+type Format string
+
+// formatMIME is a format and its MIME type
+type formatMIME struct {
+	format Format
+	mime   string
+}
+
+// knownFormats are the formats recognized in the path extensions and the Accept header,
+// in order of preference
+var knownFormats = []formatMIME{
+	{"html", "text/html"},
+	{"json", "application/json"},
+	{"xml", "application/xml"},
+	{"csv", "text/csv"},
+	{"txt", "text/plain"},
+	{"js", "text/javascript"},
+}
+
+// MIME returns the MIME type of the format, or an empty string if it is unknown
+func (f Format) MIME() string {
+	for _, k := range knownFormats {
+		if k.format == f {
+			return k.mime
+		}
+	}
+	if f == "" {
+		return ""
+	}
+	t, _, _ := mime.ParseMediaType(mime.TypeByExtension("." + string(f)))
+	return t
+}
+
+// formatOf returns the format of a MIME type: "json" for application/json, "msgpack" for application/x-msgpack
+func formatOf(mimeType string) Format {
+	for _, k := range knownFormats {
+		if k.mime == mimeType {
+			return k.format
+		}
+	}
+	if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+		return Format(strings.TrimPrefix(exts[0], "."))
+	}
+	_, subtype, _ := strings.Cut(mimeType, "/")
+	return Format(strings.TrimPrefix(subtype, "x-"))
+}
+
+type formatKey struct{}
+
+// FormatFrom returns the format of the request with the given context
+func FormatFrom(ctx context.Context) Format {
+	f, _ := ctx.Value(formatKey{}).(Format)
+	return f
+}
+
+// formats returns the formats the dispatcher can negotiate: the known ones and the ones of the renderers.
+// Draw stores them in formatList.
+func (d *Dispatcher) formats() []formatMIME {
+	list := slices.Clone(knownFormats)
+	for _, rr := range d.renderers {
+		if !slices.ContainsFunc(list, func(k formatMIME) bool { return k.mime == rr.mime }) {
+			list = append(list, formatMIME{format: rr.format, mime: rr.mime})
+		}
+	}
+	return list
+}
+
+// mimeOf returns the MIME type of a format the dispatcher can negotiate, or an empty string
+func (d *Dispatcher) mimeOf(f Format) string {
+	for _, k := range d.formatList {
+		if k.format == f {
+			return k.mime
+		}
+	}
+	return ""
+}
+
+// formatFor returns the format of a MIME type the dispatcher can negotiate
+func (d *Dispatcher) formatFor(mimeType string) Format {
+	for _, k := range d.formatList {
+		if k.mime == mimeType {
+			return k.format
+		}
+	}
+	return ""
+}
+
+// splitFormat splits the format extension from a path like /posts/1.json
+func (d *Dispatcher) splitFormat(p string) (string, Format, bool) {
+	ext := strings.ToLower(path.Ext(p))
+	if len(ext) < 2 || strings.HasSuffix(p, "/"+ext) {
+		return p, "", false
+	}
+	format := Format(ext[1:])
+	if d.mimeOf(format) == "" {
+		return p, "", false
+	}
+	return p[:len(p)-len(ext)], format, true
+}
+
+// find returns the route for the request. When the path has the extension of a format
+// the route takes, the returned request has the path without it.
+func (d *Dispatcher) find(r *http.Request) (*Route, *http.Request, Format) {
+	if base, format, ok := d.splitFormat(r.URL.Path); ok {
+		r2 := new(http.Request)
+		*r2 = *r
+		u := *r.URL
+		u.Path, u.RawPath = base, ""
+		r2.URL = &u
+		if route := d.lookup(r2); route != nil && route.takesExtension(format) {
+			return route, r2, format
+		}
+	}
+	return d.lookup(r), r, ""
+}
+
+// negotiateFormat returns the format of the route that the Accept header prefers.
+// It returns false when the route restricts its formats and the client accepts none of them.
+func (d *Dispatcher) negotiateFormat(route *Route, r *http.Request) (Format, bool) {
+	var preferred Format
+	if len(route.Formats) > 0 {
+		preferred = route.Formats[0]
+	}
+	header := r.Header.Get("Accept")
+	if anyFormat(header) {
+		return preferred, true
+	}
+
+	mimes := []string{}
+	for _, k := range d.formatList {
+		mimes = append(mimes, k.mime)
+	}
+	if len(route.Formats) > 0 {
+		mimes = []string{}
+		for _, f := range route.Formats {
+			mimes = append(mimes, d.mimeOf(f))
+		}
+	}
+	t, _ := accept.Negotiate(header, mimes...)
+	if t == "" {
+		return "", len(route.Formats) == 0
+	}
+	return d.formatFor(t), true
+}
+
+// anyFormat reports if the Accept header has no preference, like */*
+func anyFormat(header string) bool {
+	for _, a := range accept.Parse(header) {
+		if a.Type != "*" {
+			return false
+		}
+	}
+	return true
+}
+
+// takesExtension reports if the path of the route can have the extension of the format.
+// Only actions and routes with Formats take them. Routes with a * segment get the path as is.
+func (r *Route) takesExtension(f Format) bool {
+	if slices.Contains(strings.Split(r.Path, "/"), "*") {
+		return false
+	}
+	if _, ok := r.Handler.(*actionctx); !ok && len(r.Formats) == 0 {
+		return false
+	}
+	return r.allowsFormat(f)
+}
+
+// allowsFormat reports if the route can answer in the given format
+func (r *Route) allowsFormat(f Format) bool {
+	return len(r.Formats) == 0 || slices.Contains(r.Formats, f)
+}
+
+var defaultNotAcceptable = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotAcceptable)
+	w.Write([]byte(http.StatusText(http.StatusNotAcceptable)))
+})
@@ -0,0 +1,101 @@
+package lazydispatch
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type ReportsController struct{}
+
+func (c *ReportsController) Index(format Format) string {
+	return "index " + string(format)
+}
+
+func (c *ReportsController) Show(format Format, id string) string {
+	return "show " + id + " " + string(format)
+}
+
+func TestDispatcher_Format(t *testing.T) {
+	d := New()
+	d.AddRenderer("application/x-msgpack", RendererFunc(func(w io.Writer, v any) error {
+		return nil
+	}))
+	d.Draw(func(r *Scope) {
+		r.Resources(&ReportsController{}).Path("reports")
+		r.Path("api").Formats("json", "xml").Draw(func(api *Scope) {
+			api.Resources(&ReportsController{}).Path("reports")
+			api.Get("files/*").To(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(r.URL.Path + " " + string(FormatFrom(r.Context()))))
+			}))
+		})
+		echoPath := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.URL.Path + " " + string(FormatFrom(r.Context()))))
+		})
+		r.Get("assets/*").To(echoPath)
+		r.Get("pages/:id").To(echoPath)
+		r.Get("robots.txt").Formats("html").To(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("robots " + string(FormatFrom(r.Context()))))
+		}))
+	})
+
+	tests := []struct {
+		method, path, accept string
+		code                 int
+		body                 string
+	}{
+		{"GET", "/reports", "", 200, "index "},
+		{"GET", "/reports.json", "", 200, "index json"},
+		{"GET", "/reports.JSON", "", 200, "index json"},
+		{"GET", "/reports/1.csv", "", 200, "show 1 csv"},
+		{"GET", "/reports/1.msgpack", "", 200, "show 1 msgpack"},
+		{"GET", "/reports/1.unknownext", "", 200, "show 1.unknownext "},
+		{"GET", "/reports/1", "text/html,application/xhtml+xml,*/*;q=0.8", 200, "show 1 html"},
+		{"GET", "/reports/1", "application/json", 200, "show 1 json"},
+		{"GET", "/reports/1", "*/*", 200, "show 1 "},
+		{"HEAD", "/reports/1.json", "", 200, ""},
+
+		// Restricted formats
+		{"GET", "/api/reports", "", 200, "index json"},
+		{"GET", "/api/reports", "*/*", 200, "index json"},
+		{"GET", "/api/reports.xml", "", 200, "index xml"},
+		{"GET", "/api/reports", "application/xml", 200, "index xml"},
+		{"GET", "/api/reports", "text/html", 406, "Not Acceptable"},
+		{"GET", "/api/reports.html", "", 404, "Not Found"},
+		{"GET", "/api/reports/1.html", "", 200, "show 1.html json"},
+		{"GET", "/api/files/a/b.json", "", 200, "/api/files/a/b.json json"},
+		{"DELETE", "/api/reports.json", "", 405, "Method Not Allowed"},
+
+		// Extensions of formats that can't be negotiated
+		{"GET", "/reports/1.pdf", "", 200, "show 1.pdf "},
+
+		// Handlers without Formats get the path as is
+		{"GET", "/assets/app.css", "", 200, "/assets/app.css "},
+		{"GET", "/assets/data.json", "", 200, "/assets/data.json "},
+		{"GET", "/pages/about.json", "", 200, "/pages/about.json "},
+
+		// Extensions that are part of the route
+		{"GET", "/robots.txt", "", 200, "robots html"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, r)
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("%s %s (Accept: %s): expected %d %q, got %d %q", tt.method, tt.path, tt.accept, tt.code, tt.body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestFormat_MIME(t *testing.T) {
+	if Format("json").MIME() != "application/json" || Format("").MIME() != "" {
+		t.Errorf("unexpected MIME types %q %q", Format("json").MIME(), Format("").MIME())
+	}
+	if formatOf("application/x-msgpack") != "msgpack" || formatOf("text/html") != "html" {
+		t.Errorf("unexpected formats %q %q", formatOf("application/x-msgpack"), formatOf("text/html"))
+	}
+}
@@ -0,0 +1,395 @@
+package lazydispatch
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"golazy.dev/router"
+)
+
+// Host restricts the routes drawn in the scope to the requests for the given host.
+// It can include a scheme and a port, and any part can be omitted:
+//
+//	r.Host("api.example.com").Draw(func(api *Scope) { ... })
+//	r.Host("https://admin.example.com:8443").Resources(&UsersController{})
+//	r.Host(":3000").Get("metrics").To(metrics)
+//
+// Each part set in a child scope replaces the one of its parents. When many origins match a request,
+// a host goes before a :param subdomain, which goes before a port or scheme alone.
+func (s *Scope) Host(host string) *Scope {
+	s = s.newChild()
+	s.scheme, s.subdomain, s.host, s.port = parseHost(host)
+	return s
+}
+
+// Host restricts all the routes of the resources to the given host. See Scope.Host
+func (r *Resources) Host(host string) *Resources {
+	r.Scheme, r.subdomain, r.Domain, r.Port = parseHost(host)
+	return r
+}
+
+// Host restricts all the routes of the resource to the given host. See Scope.Host
+func (r *Resource) Host(host string) *Resource {
+	s := r.parentScope
+	s.scheme, s.subdomain, s.host, s.port = parseHost(host)
+	return r
+}
+
+// Subdomain restricts the routes drawn in the scope to the requests for a subdomain of the host
+// of the scope. Labels like :account capture the value of the subdomain, that actions and generators
+// receive as the outermost path parameter or in Subdomains.
+//
+//	r.Host("example.com").Subdomain(":account").Draw(func(app *Scope) {
+//		app.Resources(&ProjectsController{}) // acme.example.com/projects
+//	})
+//
+// The scope needs a host, as the domain of a request can't be told apart from its subdomain.
+// Draw panics for the routes with a subdomain and no host.
+func (s *Scope) Subdomain(subdomain string) *Scope {
+	s = s.newChild()
+	s.subdomain = strings.ToLower(subdomain)
+	return s
+}
+
+// parseHost splits a host like https://:account.example.com:8080 in its scheme, subdomain, hostname and port
+func parseHost(host string) (scheme, subdomain, hostname, port string) {
+	origin, path := splitOrigin(host)
+	if origin == "" {
+		origin, path = splitOrigin("//" + host)
+	}
+	if path != "" && path != "/" {
+		panic(fmt.Sprintf("invalid host %q: it has a path", host))
+	}
+	return parseOrigin(origin)
+}
+
+// splitOrigin splits an absolute URL like https://example.com/posts in the origin and the path.
+// The origin is empty when the URL isn't absolute.
+func splitOrigin(u string) (origin, path string) {
+	start := strings.Index(u, "//")
+	if start < 0 || (start > 0 && !strings.HasSuffix(u[:start], ":")) || strings.Contains(u[:start], "/") {
+		return "", u
+	}
+	end := strings.Index(u[start+2:], "/")
+	if end < 0 {
+		return u, ""
+	}
+	return u[:start+2+end], u[start+2+end:]
+}
+
+// parseOrigin splits an origin like https://:account.example.com:8080 in its parts.
+// The subdomain is made of the labels of the host up to the last :param one, and a * host matches any domain.
+func parseOrigin(origin string) (scheme, subdomain, host, port string) {
+	if i := strings.Index(origin, "://"); i >= 0 {
+		scheme, origin = strings.ToLower(origin[:i]), origin[i+3:]
+	} else {
+		origin = strings.TrimPrefix(origin, "//")
+	}
+	host = strings.ToLower(origin)
+	if i := strings.LastIndex(host, ":"); i >= 0 && isPort(host[i+1:]) {
+		host, port = host[:i], host[i+1:]
+	}
+	labels := strings.Split(host, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		if isParam(labels[i]) {
+			subdomain, host = strings.Join(labels[:i+1], "."), strings.Join(labels[i+1:], ".")
+			break
+		}
+	}
+	if host == "*" {
+		host = ""
+	}
+	return scheme, subdomain, host, port
+}
+
+func isPort(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// restrict sets the parts of the origin of the route that are not empty.
+// Unless override is set, only the ones the route doesn't have yet are set.
+func (route *Route) restrict(scheme, subdomain, host, port string, override bool) {
+	set := func(field *string, v string) {
+		if v != "" && (override || *field == "") {
+			*field = v
+		}
+	}
+	set(&route.Scheme, scheme)
+	set(&route.Subdomain, subdomain)
+	set(&route.Host, host)
+	set(&route.Port, port)
+}
+
+// assignOrigin moves the scheme, subdomain, host and port of an absolute URL like
+// http://example.com:8080/posts to the route, leaving the path in the URL
+func (route *Route) assignOrigin() {
+	origin, path := splitOrigin(route.URL)
+	if origin == "" {
+		return
+	}
+	scheme, subdomain, host, port := parseOrigin(origin)
+	if route.origin() == "" {
+		route.Scheme, route.Subdomain, route.Host, route.Port = scheme, subdomain, host, port
+	}
+	route.URL = path
+}
+
+// origin returns the scheme, subdomain, host and port the route is restricted to, like https://example.com:8080,
+// or an empty string if it isn't restricted. Without a scheme it is protocol relative, like //example.com
+func (route *Route) origin() string {
+	if route.Scheme == "" && route.Subdomain == "" && route.Host == "" && route.Port == "" {
+		return ""
+	}
+	host := route.Host
+	if route.Subdomain != "" {
+		if host == "" {
+			host = "*"
+		}
+		host = route.Subdomain + "." + host
+	}
+	if route.Port != "" {
+		host += ":" + route.Port
+	}
+	if route.Scheme == "" {
+		return "//" + host
+	}
+	return route.Scheme + "://" + host
+}
+
+// Subdomains are the values of the :params in the subdomain of the route, like {"account": "acme"}
+// for :account.example.com. Actions, filters and generators can ask for them:
+//
+//	func (c *ProjectsController) Gen_Account(s lazydispatch.Subdomains) (*Account, error) {
+//		return FindAccount(s["account"])
+//	}
+type Subdomains map[string]string
+
+type subdomainsKey struct{}
+
+// SubdomainsFrom returns the subdomain parameters of the request with the given context
+func SubdomainsFrom(ctx context.Context) Subdomains {
+	s, _ := ctx.Value(subdomainsKey{}).(Subdomains)
+	return s
+}
+
+// subdomainParams returns the names of the :params of a subdomain like :account.:region
+func subdomainParams(subdomain string) []string {
+	names := []string{}
+	for _, label := range strings.Split(subdomain, ".") {
+		if isParam(label) {
+			names = append(names, label[1:])
+		}
+	}
+	return names
+}
+
+// matchHost matches the hostname of a request with the subdomain and host of a route
+// and returns the values of the subdomain parameters
+func matchHost(subdomain, host, hostname string) (Subdomains, bool) {
+	hostname = strings.ToLower(hostname)
+	if subdomain == "" {
+		return nil, host == "" || host == hostname
+	}
+
+	prefix, ok := strings.CutSuffix(hostname, "."+host)
+	if host == "" || !ok {
+		return nil, false
+	}
+
+	patterns, labels := strings.Split(subdomain, "."), strings.Split(prefix, ".")
+	if len(patterns) != len(labels) {
+		return nil, false
+	}
+	values := Subdomains{}
+	for i, p := range patterns {
+		switch {
+		case labels[i] == "":
+			return nil, false
+		case isParam(p):
+			values[p[1:]] = labels[i]
+		case p != labels[i]:
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// originRouter holds the routes restricted to the same origin
+type originRouter struct {
+	route *Route // route is the first route of the router, that has its scheme, subdomain, host and port
+	httpr *router.Router[Route]
+}
+
+// matches reports if the request with the scheme is for the origin of the router
+func (o *originRouter) matches(r *http.Request, scheme string) bool {
+	_, ok := o.route.matchOrigin(r, scheme)
+	return ok
+}
+
+// matchOrigin reports if the request with the scheme is for the scheme, subdomain, host and port of the route,
+// and returns the values of the subdomain parameters
+func (route *Route) matchOrigin(r *http.Request, scheme string) (Subdomains, bool) {
+	if route.Scheme != "" && route.Scheme != scheme {
+		return nil, false
+	}
+	host, port := splitHostPort(r.Host)
+	if route.Port != "" {
+		if port == "" {
+			port = defaultPort(scheme)
+		}
+		if route.Port != port {
+			return nil, false
+		}
+	}
+	return matchHost(route.Subdomain, route.Host, host)
+}
+
+// add registers the route in the router for its origin
+func (d *Dispatcher) add(route *Route) {
+	def := &router.RouteDefinition{Method: route.Method, Path: route.Path}
+	origin := route.origin()
+	if origin == "" {
+		d.httpr.Add(def, route)
+		return
+	}
+	for _, o := range d.origins {
+		if o.route.origin() == origin {
+			o.httpr.Add(def, route)
+			return
+		}
+	}
+	o := &originRouter{route: route, httpr: router.NewRouter[Route]()}
+	o.httpr.Add(def, route)
+	// Keep the origins from the most to the least specific, in drawing order when they are as specific
+	rank := route.originRank()
+	i := slices.IndexFunc(d.origins, func(o *originRouter) bool { return o.route.originRank() < rank })
+	if i < 0 {
+		i = len(d.origins)
+	}
+	d.origins = slices.Insert(d.origins, i, o)
+}
+
+// originRank returns how specific the origin of the route is. A host without subdomain parameters
+// goes before one with them, and then the routes with a port and a scheme go first.
+func (route *Route) originRank() int {
+	rank := 0
+	if route.Host != "" {
+		rank += 4
+		if len(subdomainParams(route.Subdomain)) == 0 {
+			rank += 4
+		}
+	}
+	if route.Port != "" {
+		rank += 2
+	}
+	if route.Scheme != "" {
+		rank++
+	}
+	return rank
+}
+
+// lookup returns the route for the request. The routes restricted to the origin
+// of the request are tried before the ones that aren't restricted, the most specific origins first.
+func (d *Dispatcher) lookup(r *http.Request) *Route {
+	scheme := d.requestScheme(r)
+	for _, o := range d.origins {
+		if !o.matches(r, scheme) {
+			continue
+		}
+		if route := o.httpr.Find(r); route != nil {
+			return route
+		}
+	}
+	return d.httpr.Find(r)
+}
+
+// URLFor returns the absolute URL of a route, taking the arguments of PathFor.
+// The scheme, host and port the route isn't restricted to are the ones of the request.
+//
+//	d.URLFor(r, &Post{ID: 1}) // => "https://example.com/posts/1"
+//	d.URLFor(r, "projects", "acme") // => "https://acme.example.com/projects" for :account.example.com/projects
+func (d *Dispatcher) URLFor(r *http.Request, args ...any) string {
+	route, subdomain, path := d.names.find(args...)
+	scheme := route.Scheme
+	if scheme == "" {
+		scheme = d.requestScheme(r)
+	}
+	host, port := splitHostPort(r.Host)
+	if route.Host != "" {
+		host, port = route.Host, ""
+	}
+	if subdomain != "" {
+		host = subdomain + "." + host
+	}
+	if route.Port != "" {
+		port = route.Port
+	}
+	if port != "" && port != defaultPort(scheme) {
+		host = net.JoinHostPort(host, port)
+	}
+	return scheme + "://" + host + path
+}
+
+// requestScheme returns https for TLS requests and http otherwise. With TrustForwardedProto
+// the proto of the Forwarded header, or else the X-Forwarded-Proto header, goes first.
+func (d *Dispatcher) requestScheme(r *http.Request) string {
+	if d.TrustForwardedProto {
+		if scheme := forwardedProto(r.Header); scheme != "" {
+			return scheme
+		}
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// forwardedProto returns the scheme the client used, set by the first proxy in the Forwarded header,
+// like Forwarded: for=192.0.2.60;proto=https, or in X-Forwarded-Proto. It is empty if it isn't http or https.
+func forwardedProto(h http.Header) string {
+	var proto string
+	if forwarded := h.Get("Forwarded"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		for _, pair := range strings.Split(first, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			if strings.EqualFold(key, "proto") {
+				proto = strings.Trim(value, `"`)
+			}
+		}
+	} else {
+		proto, _, _ = strings.Cut(h.Get("X-Forwarded-Proto"), ",")
+	}
+	proto = strings.ToLower(strings.TrimSpace(proto))
+	if proto != "http" && proto != "https" {
+		return ""
+	}
+	return proto
+}
+
+// splitHostPort splits a host like example.com:8080 or [::1]:8080. The port is empty if it has none.
+func splitHostPort(hostport string) (string, string) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return strings.Trim(hostport, "[]"), ""
+	}
+	return host, port
+}
+
+func defaultPort(scheme string) string {
+	if scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
@@ -0,0 +1,273 @@
+package lazydispatch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func text(s string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(s))
+	})
+}
+
+func TestRoute_NormalizeOrigin(t *testing.T) {
+	tests := []struct {
+		url, scheme, host, port, path, normalized string
+	}{
+		{"/posts/1", "", "", "", "/posts/1", "/posts/1"},
+		{"http://example.com:8080/posts/1", "http", "example.com", "8080", "/posts/1", "http://example.com:8080/posts/1"},
+		{"https://Example.com/posts/1", "https", "example.com", "", "/posts/1", "https://example.com/posts/1"},
+		{"//example.com/posts/1", "", "example.com", "", "/posts/1", "//example.com/posts/1"},
+		{"//:3000/posts/1", "", "", "3000", "/posts/1", "//:3000/posts/1"},
+		{"http://:3000/posts/1", "http", "", "3000", "/posts/1", "http://:3000/posts/1"},
+		{"https://example.com", "https", "example.com", "", "/", "https://example.com/"},
+	}
+	for _, tt := range tests {
+		r := &Route{URL: tt.url}
+		r.normalize()
+		r.normalize()
+		if r.Scheme != tt.scheme || r.Host != tt.host || r.Port != tt.port || r.Path != tt.path || r.URL != tt.normalized {
+			t.Errorf("%s: expected %q %q %q %q %q, got %q %q %q %q %q", tt.url,
+				tt.scheme, tt.host, tt.port, tt.path, tt.normalized,
+				r.Scheme, r.Host, r.Port, r.Path, r.URL)
+		}
+	}
+}
+
+func TestDispatcher_Host(t *testing.T) {
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Get("status").To(text("status"))
+		r.Host("api.example.com").Draw(func(api *Scope) {
+			api.Get("status").To(text("api status"))
+			api.Get("users").As("users").To(text("api users"))
+		})
+		r.Host("https://admin.example.com").Get("status").As("admin_status").To(text("admin status"))
+		r.Host(":9090").Get("metrics").As("metrics").To(text("metrics"))
+		r.Resources(&PostsController{}).Path("posts").Host("blog.example.com")
+	})
+
+	tests := []struct {
+		method, url string
+		code        int
+		body        string
+	}{
+		{"GET", "http://example.com/status", 200, "status"},
+		{"GET", "http://api.example.com/status", 200, "api status"},
+		{"GET", "http://API.example.com:80/status", 200, "api status"},
+		{"GET", "http://api.example.com/users", 200, "api users"},
+		{"GET", "http://example.com/users", 404, "Not Found"},
+		{"GET", "http://admin.example.com/status", 200, "status"},
+		{"GET", "https://admin.example.com/status", 200, "admin status"},
+		{"GET", "http://example.com:9090/metrics", 200, "metrics"},
+		{"GET", "http://example.com/metrics", 404, "Not Found"},
+		{"DELETE", "http://api.example.com/users", 405, "Method Not Allowed"},
+		{"GET", "http://blog.example.com/posts", 200, "index"},
+		{"GET", "http://example.com/posts", 404, "Not Found"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, nil))
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("%s %s: expected %d %q, got %d %q", tt.method, tt.url, tt.code, tt.body, w.Code, w.Body.String())
+		}
+	}
+
+	for _, tt := range []struct {
+		args     []any
+		path     string
+		expected string
+	}{
+		{[]any{"users"}, "//api.example.com/users", "https://api.example.com/users"},
+		{[]any{"admin_status"}, "https://admin.example.com/status", "https://admin.example.com/status"},
+		{[]any{"metrics"}, "//:9090/metrics", "https://example.com:9090/metrics"},
+		{[]any{"posts"}, "//blog.example.com/posts", "https://blog.example.com/posts"},
+	} {
+		if path := d.PathFor(tt.args...); path != tt.path {
+			t.Errorf("PathFor(%v): expected %q, got %q", tt.args, tt.path, path)
+		}
+		r := httptest.NewRequest("GET", "https://example.com/", nil)
+		if url := d.URLFor(r, tt.args...); url != tt.expected {
+			t.Errorf("URLFor(%v): expected %q, got %q", tt.args, tt.expected, url)
+		}
+	}
+}
+
+func TestDispatcher_HostSpecificity(t *testing.T) {
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Host(":3000").Get("status").To(text("port"))
+		r.Host(":tenant.example.com").Get("status").To(text("tenant"))
+		r.Host("api.example.com").Get("status").To(text("api"))
+		r.Host("api.example.com:3000").Get("status").To(text("api port"))
+	})
+
+	for url, expected := range map[string]string{
+		"http://api.example.com:3000/status":  "api port",
+		"http://api.example.com/status":       "api",
+		"http://acme.example.com:3000/status": "tenant",
+		"http://example.org:3000/status":      "port",
+	} {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Body.String() != expected {
+			t.Errorf("GET %s: expected %q, got %q", url, expected, w.Body.String())
+		}
+	}
+}
+
+func TestDispatcher_TrustForwardedProto(t *testing.T) {
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Get("status").As("status").To(text("status"))
+		r.Host("https://admin.example.com").Get("status").To(text("admin status"))
+	})
+
+	tests := []struct {
+		trust         bool
+		header, value string
+		body, url     string
+	}{
+		{false, "X-Forwarded-Proto", "https", "status", "http://admin.example.com/status"},
+		{true, "X-Forwarded-Proto", "https", "admin status", "https://admin.example.com/status"},
+		{true, "X-Forwarded-Proto", "HTTPS, http", "admin status", "https://admin.example.com/status"},
+		{true, "Forwarded", `for=192.0.2.60;proto="https", for=10.0.0.1;proto=http`, "admin status", "https://admin.example.com/status"},
+		{true, "Forwarded", "for=192.0.2.60", "status", "http://admin.example.com/status"},
+		{true, "X-Forwarded-Proto", "gopher", "status", "http://admin.example.com/status"},
+	}
+	for _, tt := range tests {
+		d.TrustForwardedProto = tt.trust
+		r := httptest.NewRequest("GET", "http://admin.example.com/status", nil)
+		r.Header.Set(tt.header, tt.value)
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, r)
+		if w.Body.String() != tt.body {
+			t.Errorf("%s: %s (trusted %v): expected %q, got %q", tt.header, tt.value, tt.trust, tt.body, w.Body.String())
+		}
+		if url := d.URLFor(r, "status"); url != tt.url {
+			t.Errorf("%s: %s (trusted %v): expected URLFor %q, got %q", tt.header, tt.value, tt.trust, tt.url, url)
+		}
+	}
+}
+
+func TestDispatcher_URLFor(t *testing.T) {
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Get("posts").As("posts").To(text("posts"))
+	})
+	for url, expected := range map[string]string{
+		"http://example.com/":       "http://example.com/posts",
+		"https://example.com:443/":  "https://example.com/posts",
+		"http://localhost:3000/a/b": "http://localhost:3000/posts",
+	} {
+		r := httptest.NewRequest("GET", url, nil)
+		if u := d.URLFor(r, "posts"); u != expected {
+			t.Errorf("%s: expected %q, got %q", url, expected, u)
+		}
+	}
+	if path := d.PathFor("posts"); path != "/posts" {
+		t.Errorf("expected /posts, got %q", path)
+	}
+}
+
+type Tenant struct {
+	Name string
+}
+
+type ProjectsController struct{}
+
+func (c *ProjectsController) Gen_Tenant(s Subdomains) Tenant {
+	return Tenant{Name: s["account"]}
+}
+
+func (c *ProjectsController) Index(tenant Tenant) string {
+	return tenant.Name + " projects"
+}
+
+func (c *ProjectsController) Show(id, account string) string {
+	return "project " + id + " of " + account
+}
+
+func TestDispatcher_Subdomain(t *testing.T) {
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Host("example.com").Draw(func(r *Scope) {
+			r.Get("projects").To(text("landing"))
+			r.Subdomain(":account").Draw(func(app *Scope) {
+				app.Resources(&ProjectsController{}).Path("projects")
+			})
+		})
+		r.Host("example.co.uk").Subdomain(":account.:region").Get("status").As("region_status").To(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s := SubdomainsFrom(r.Context())
+			w.Write([]byte(s["account"] + " " + s["region"]))
+		}))
+	})
+
+	tests := []struct {
+		url  string
+		code int
+		body string
+	}{
+		{"http://acme.example.com/projects", 200, "acme projects"},
+		{"http://Acme.example.com/projects/7", 200, "project 7 of acme"},
+		{"http://example.com/projects", 200, "landing"},
+		{"http://a.b.example.com/projects", 404, "Not Found"},
+		{"http://acme.example.org/projects", 404, "Not Found"},
+		{"http://acme.eu.example.co.uk/status", 200, "acme eu"},
+		{"http://acme.example.co.uk/status", 404, "Not Found"},
+		{"http://acme.eu.example.org/status", 404, "Not Found"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("GET %s: expected %d %q, got %d %q", tt.url, tt.code, tt.body, w.Code, w.Body.String())
+		}
+	}
+
+	if path := d.PathFor("project", "acme", 7); path != "//acme.example.com/projects/7" {
+		t.Errorf("expected //acme.example.com/projects/7, got %q", path)
+	}
+	if path := d.PathFor("region_status", "acme", "eu"); path != "//acme.eu.example.co.uk/status" {
+		t.Errorf("expected //acme.eu.example.co.uk/status, got %q", path)
+	}
+	r := httptest.NewRequest("GET", "https://www.example.co.uk/", nil)
+	if url := d.URLFor(r, "region_status", "acme", "eu"); url != "https://acme.eu.example.co.uk/status" {
+		t.Errorf("expected https://acme.eu.example.co.uk/status, got %q", url)
+	}
+
+	func() {
+		defer func() {
+			if err := recover(); err == nil || !strings.Contains(fmt.Sprint(err), "subdomain :account has no host") {
+				t.Errorf("expected Draw to panic for a subdomain without host, got %v", err)
+			}
+		}()
+		New().Draw(func(r *Scope) {
+			r.Subdomain(":account").Get("status").To(text("status"))
+		})
+	}()
+}
+
+func TestParseHost(t *testing.T) {
+	tests := []struct {
+		host                              string
+		scheme, subdomain, hostname, port string
+	}{
+		{"example.com", "", "", "example.com", ""},
+		{"https://example.com:8443", "https", "", "example.com", "8443"},
+		{":3000", "", "", "", "3000"},
+		{":account.example.com", "", ":account", "example.com", ""},
+		{"http://www.:account.example.com:8080", "http", "www.:account", "example.com", "8080"},
+		{":account.*", "", ":account", "", ""},
+	}
+	for _, tt := range tests {
+		scheme, subdomain, hostname, port := parseHost(tt.host)
+		if scheme != tt.scheme || subdomain != tt.subdomain || hostname != tt.hostname || port != tt.port {
+			t.Errorf("%s: expected %q %q %q %q, got %q %q %q %q", tt.host, tt.scheme, tt.subdomain, tt.hostname, tt.port, scheme, subdomain, hostname, port)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package lazydispatch
+
+import (
+	"net/http"
+	"strings"
+)
+
+// implicitHeadRoutes returns a HEAD route for every GET route that does not
+// have an explicit HEAD route drawn for the same origin and path.
+// The HEAD route runs the GET handler and drops the body.
+func implicitHeadRoutes(routes []*Route) []*Route {
+	drawn := map[string]bool{}
+	for _, route := range routes {
+		if route.Handler != nil && hasMethod(route.Method, http.MethodHead) {
+			drawn[routeKey(route)] = true
+		}
+	}
+
+	heads := []*Route{}
+	for _, route := range routes {
+		if route.Handler == nil || !hasMethod(route.Method, http.MethodGet) || drawn[routeKey(route)] {
+			continue
+		}
+		drawn[routeKey(route)] = true
+
+		head := *route
+		head.Method = http.MethodHead
+		head.implicitHead = true
+		heads = append(heads, &head)
+	}
+	return heads
+}
+
+// implicitOptionsRoutes returns an OPTIONS route for every path that does not have an explicit
+// OPTIONS route, with the middlewares of the first route drawn for it, so that middlewares like
+// CORS can answer preflight requests. The dispatcher sets their handler, that answers the Allow header.
+func implicitOptionsRoutes(routes []*Route) []*Route {
+	drawn := map[string]bool{}
+	for _, route := range routes {
+		if route.Handler != nil && hasMethod(route.Method, http.MethodOptions) {
+			drawn[routeKey(route)] = true
+		}
+	}
+
+	options := []*Route{}
+	for _, route := range routes {
+		if route.Handler == nil || drawn[routeKey(route)] {
+			continue
+		}
+		drawn[routeKey(route)] = true
+
+		opts := *route
+		opts.Method = http.MethodOptions
+		opts.Target = ""
+		opts.Formats = nil
+		options = append(options, &opts)
+	}
+	return options
+}
+
+// routeKey identifies the origin and path of a route, with any name for its parameters
+func routeKey(route *Route) string {
+	return route.origin() + pathPattern(route.Path)
+}
+
+// hasMethod reports if a route method definition like "PUT,PATCH" includes method
+func hasMethod(methods, method string) bool {
+	for _, m := range strings.Split(methods, ",") {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func headHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(headResponseWriter{w}, r)
+	})
+}
+
+// headResponseWriter keeps the headers and the status code but discards the body
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,140 @@
+package lazydispatch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestImplicitRoutes_Head(t *testing.T) {
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Resources(&PostsController{})
+	})
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("HEAD", "/posts", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("expected empty body, got %q", w.Body.String())
+	}
+
+	expect2(t, d, "HEAD", "/unknown", nil, http.StatusNotFound, "Not Found")
+}
+
+type RouteMethodController struct{}
+
+func (c *RouteMethodController) Index(w http.ResponseWriter, route *Route) {
+	w.Header().Set("X-Route-Method", route.Method)
+	w.Write([]byte("index"))
+}
+
+func TestImplicitRoutes_HeadRoute(t *testing.T) {
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Resources(&RouteMethodController{}).Path("things")
+	})
+
+	for _, method := range []string{"GET", "HEAD"} {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest(method, "/things", nil))
+		if got := w.Header().Get("X-Route-Method"); got != method {
+			t.Errorf("%s: expected the action to get the %s route, got %q", method, method, got)
+		}
+	}
+}
+
+func TestImplicitRoutes_Options(t *testing.T) {
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Resources(&PostsController{})
+	})
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/posts", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected code %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS, POST" {
+		t.Errorf("expected Allow header %q, got %q", "GET, HEAD, OPTIONS, POST", allow)
+	}
+
+	expect2(t, d, "OPTIONS", "/unknown", nil, http.StatusNotFound, "Not Found")
+}
+
+func TestImplicitRoutes_ExplicitWins(t *testing.T) {
+	handler := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Handler", body)
+			w.Write([]byte(body))
+		})
+	}
+
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Get("/ping").To(handler("get"))
+		r.Head("/ping").To(handler("head"))
+		r.Options("/ping").To(handler("options"))
+		r.Get("/posts/:post_id").To(handler("get"))
+		r.Head("/posts/:id").To(handler("head"))
+	})
+
+	for _, path := range []string{"/ping", "/posts/1"} {
+		for _, method := range []string{"HEAD", "OPTIONS"} {
+			if path != "/ping" && method == "OPTIONS" {
+				continue
+			}
+			w := httptest.NewRecorder()
+			d.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+			if h := w.Header().Get("X-Handler"); h != strings.ToLower(method) {
+				t.Errorf("%s %s: expected the %q handler, got %q", method, path, strings.ToLower(method), h)
+			}
+		}
+	}
+	for _, route := range d.served {
+		if route.implicitHead {
+			t.Errorf("expected no implicit HEAD route, got one for %s", route.Path)
+		}
+	}
+}
+
+func TestImplicitRoutes_OptionsMiddlewares(t *testing.T) {
+	cors := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			if r.Method == http.MethodOptions {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Path("api").Use(cors).Draw(func(api *Scope) {
+			api.Resources(&PostsController{})
+		})
+		r.Get("home").To(http.NotFoundHandler())
+	})
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/api/posts/1", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected code %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST" {
+		t.Errorf("expected the scope middlewares to answer the preflight, got %q", got)
+	}
+	if allow := w.Header().Get("Allow"); allow != "DELETE, GET, HEAD, OPTIONS, PATCH, PUT" {
+		t.Errorf("expected Allow header %q, got %q", "DELETE, GET, HEAD, OPTIONS, PATCH, PUT", allow)
+	}
+
+	w = httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/home", nil))
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected the routes out of the scope to skip its middlewares, got %d %v", w.Code, w.Header())
+	}
+}
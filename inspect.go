@@ -0,0 +1,96 @@
+package lazydispatch
+
+import (
+	"reflect"
+	"runtime"
+	"sort"
+)
+
+// RouteInfo describes a drawn route. It is returned by Dispatcher.Inspect
+type RouteInfo struct {
+	Method      string   `json:"method"`
+	Origin      string   `json:"origin,omitempty"` // Origin is the scheme, host and port the route is restricted to
+	Path        string   `json:"path"`
+	Name        string   `json:"name,omitempty"`
+	Namespace   string   `json:"namespace,omitempty"`
+	Controller  string   `json:"controller,omitempty"`
+	Action      string   `json:"action,omitempty"`
+	Target      string   `json:"target,omitempty"`
+	Models      []string `json:"models,omitempty"`
+	Middlewares []string `json:"middlewares,omitempty"`
+}
+
+// Inspect returns a description of every drawn route sorted by path and method.
+// The output is stable between calls, so it can be used to print or diff the route table.
+//
+//	for _, r := range dispatcher.Inspect() {
+//		fmt.Println(r.Method, r.Path, r.Target)
+//	}
+func (d *Dispatcher) Inspect() []RouteInfo {
+	middlewares := []string{}
+	for _, m := range d.middlewares {
+		middlewares = append(middlewares, funcName(m))
+	}
+	for _, m := range d.routed {
+		middlewares = append(middlewares, funcName(m))
+	}
+
+	infos := make([]RouteInfo, 0, len(d.Routes))
+	for _, route := range d.Routes {
+		info := RouteInfo{
+			Method:     route.Method,
+			Origin:     route.origin(),
+			Path:       route.Path,
+			Name:       route.Name,
+			Namespace:  route.Namespace,
+			Controller: route.Controller,
+			Action:     route.Action,
+			Target:     route.Target,
+		}
+		if info.Path == "" {
+			info.Path = route.URL
+		}
+		for _, m := range route.Models {
+			info.Models = append(info.Models, modelName(m))
+		}
+		if len(middlewares) > 0 {
+			info.Middlewares = append([]string{}, middlewares...)
+		}
+		for _, mw := range d.namedFor(route) {
+			info.Middlewares = append(info.Middlewares, mw.name)
+		}
+		for _, m := range route.Middlewares {
+			info.Middlewares = append(info.Middlewares, funcName(m))
+		}
+		infos = append(infos, info)
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		if infos[i].Path != infos[j].Path {
+			return infos[i].Path < infos[j].Path
+		}
+		return infos[i].Method < infos[j].Method
+	})
+	return infos
+}
+
+// modelName returns the type of the model or "any" for the placeholders added by Route.normalize
+func modelName(m any) string {
+	if m == nil || m == any(struct{}{}) {
+		return "any"
+	}
+	return reflect.TypeOf(m).String()
+}
+
+// funcName returns the full name of the function f
+func funcName(f any) string {
+	v := reflect.ValueOf(f)
+	if v.Kind() != reflect.Func {
+		return v.Type().String()
+	}
+	fn := runtime.FuncForPC(v.Pointer())
+	if fn == nil {
+		return v.Type().String()
+	}
+	return fn.Name()
+}
@@ -0,0 +1,32 @@
+package lazydispatch
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func logMiddleware(next http.Handler) http.Handler {
+	return next
+}
+
+func TestDispatcher_Inspect(t *testing.T) {
+	d := New()
+	d.Use(logMiddleware)
+	d.Draw(func(r *Scope) {
+		r.Resources(&PagesController{}, &Post{})
+	})
+
+	expected := []RouteInfo{
+		{Method: "GET", Path: "/pages", Name: "pages", Controller: "PagesController", Action: "index", Target: "PagesController#Index"},
+		{Method: "GET", Path: "/pages/:page_id", Name: "page", Controller: "PagesController", Action: "show", Target: "PagesController#Show", Models: []string{"*lazydispatch.Post"}},
+	}
+	for i := range expected {
+		expected[i].Middlewares = []string{"golazy.dev/lazydispatch.logMiddleware"}
+	}
+
+	infos := d.Inspect()
+	if !reflect.DeepEqual(infos, expected) {
+		t.Errorf("expected %+v\ngot %+v", expected, infos)
+	}
+}
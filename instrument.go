@@ -0,0 +1,191 @@
+package lazydispatch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// EventKind tells which part of the request an Event is about
+type EventKind int
+
+const (
+	EventRequest      EventKind = iota // The request served by an action
+	EventFilter                        // A Before_ filter
+	EventGenerator                     // A Gen_ method
+	EventAction                        // The action
+	EventAfterFilter                   // An After_ filter
+	EventErrorHandler                  // HandleError
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventRequest:
+		return "request"
+	case EventFilter:
+		return "filter"
+	case EventGenerator:
+		return "generator"
+	case EventAction:
+		return "action"
+	case EventAfterFilter:
+		return "after_filter"
+	case EventErrorHandler:
+		return "error_handler"
+	}
+	return "unknown"
+}
+
+// Event describes a step of a request. It is passed to the Instrumenters
+type Event struct {
+	Kind EventKind
+
+	// Name is the name of the method. For EventRequest it is the target of the route, like "PostsController#Show"
+	Name string
+
+	// Route is the route that matched the request. It is nil if the action is not served by a route.
+	Route *Route
+
+	Request *http.Request
+
+	// Duration is the time spent in the step. Only set on Finish
+	Duration time.Duration
+
+	// Err is the error that stopped the step, if any. For EventErrorHandler it is the handled error.
+	// Only set on Finish
+	Err error
+
+	// Status is the response status code. Only set on Finish of EventRequest
+	Status int
+}
+
+// Instrumenter receives an event when each step of a request starts and finishes.
+//
+// The context returned by Start is the one used by the step: it is available
+// to the methods that ask for a context.Context, to the nested steps
+// (like the generators of an action) and it is passed to Finish.
+type Instrumenter interface {
+	Start(ctx context.Context, e Event) context.Context
+	Finish(ctx context.Context, e Event)
+}
+
+// Instrument adds an Instrumenter to the dispatcher.
+// Instrumenters are called in the order they are added on Start and in the
+// reverse order on Finish. They have to be added before calling Draw.
+func (d *Dispatcher) Instrument(i Instrumenter) {
+	d.instrumenters = append(d.instrumenters, i)
+}
+
+// tracker follows a request to log and instrument it.
+// It is only created when there is debug logging or instrumenters.
+// A nil *tracker just calls the measured functions.
+type tracker struct {
+	actx    *actionctx
+	route   *Route
+	start   time.Time
+	log     bool
+	timings []any
+	err     error // err is the last error passed to the error handler
+}
+
+func newTracker(actx *actionctx, r *http.Request) *tracker {
+	if len(actx.instrumenters) == 0 && !actx.logger.Enabled(r.Context(), slog.LevelDebug) {
+		return nil
+	}
+	t := &tracker{
+		actx:  actx,
+		start: time.Now(),
+		log:   actx.logger.Enabled(r.Context(), slog.LevelDebug),
+	}
+	t.route = RouteFrom(r.Context())
+	return t
+}
+
+func (t *tracker) target() string {
+	if t.route != nil && t.route.Target != "" {
+		return t.route.Target
+	}
+	return t.actx.tt.String() + "#" + t.actx.name
+}
+
+func (t *tracker) event(kind EventKind, name string, r *http.Request) Event {
+	return Event{Kind: kind, Name: name, Route: t.route, Request: r}
+}
+
+func (t *tracker) startEvent(r *http.Request, e Event) *http.Request {
+	ctx := r.Context()
+	for _, i := range t.actx.instrumenters {
+		ctx = i.Start(ctx, e)
+	}
+	if ctx == r.Context() {
+		return r
+	}
+	return r.WithContext(ctx)
+}
+
+func (t *tracker) finishEvent(ctx context.Context, e Event) {
+	for i := len(t.actx.instrumenters) - 1; i >= 0; i-- {
+		t.actx.instrumenters[i].Finish(ctx, e)
+	}
+}
+
+func (t *tracker) startRequest(r *http.Request) *http.Request {
+	return t.startEvent(r, t.event(EventRequest, t.target(), r))
+}
+
+func (t *tracker) finishRequest(r *http.Request, w *statusRecorder) {
+	e := t.event(EventRequest, t.target(), r)
+	e.Duration = time.Since(t.start)
+	// net/http answers 200 when the handler writes nothing,
+	// and the recovery of the Dispatcher the status of the error when it fails without ErrorHandler
+	if w.status == 0 && t.err != nil {
+		w.status = StatusCode(t.err)
+	} else if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	e.Status = w.status
+	e.Err = t.err
+	t.finishEvent(r.Context(), e)
+	if t.log {
+		t.logRequest(r, w)
+	}
+}
+
+// measure calls fn with the method of cctx as a step of the given kind.
+// The step is finished even when fn panics, with the panic as its error.
+func (t *tracker) measure(kind EventKind, cctx callctx, fn func(cctx callctx) error) (err error) {
+	if t == nil {
+		return fn(cctx)
+	}
+	e := t.event(kind, cctx.mi.name, cctx.r)
+	cctx.r = t.startEvent(cctx.r, e)
+
+	start := time.Now()
+	defer func() {
+		p := recover()
+		e.Duration = time.Since(start)
+		switch {
+		case p != nil:
+			var ok bool
+			if e.Err, ok = p.(error); !ok {
+				e.Err = fmt.Errorf("panic: %v", p)
+			}
+		case kind == EventErrorHandler:
+			e.Err = cctx.err
+		case err == errStop:
+			e.Err = t.err
+		default:
+			e.Err = err
+		}
+		if t.log {
+			t.timings = append(t.timings, slog.Duration(e.Name, e.Duration))
+		}
+		t.finishEvent(cctx.r.Context(), e)
+		if p != nil {
+			panic(p)
+		}
+	}()
+	return fn(cctx)
+}
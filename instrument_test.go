@@ -0,0 +1,109 @@
+package lazydispatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type eventNameKey struct{}
+
+type recordingInstrumenter struct {
+	t      *testing.T
+	events []string
+}
+
+func (i *recordingInstrumenter) Start(ctx context.Context, e Event) context.Context {
+	i.events = append(i.events, fmt.Sprintf("start %s %s", e.Kind, e.Name))
+	return context.WithValue(ctx, eventNameKey{}, e.Name)
+}
+
+func (i *recordingInstrumenter) Finish(ctx context.Context, e Event) {
+	if name := ctx.Value(eventNameKey{}); name != e.Name {
+		i.t.Errorf("expected the context of %s to be the one returned by Start, got the one of %v", e.Name, name)
+	}
+	event := fmt.Sprintf("finish %s %s", e.Kind, e.Name)
+	if e.Err != nil {
+		event += " err=" + e.Err.Error()
+	}
+	if e.Kind == EventRequest {
+		event += fmt.Sprintf(" status=%d", e.Status)
+	}
+	i.events = append(i.events, event)
+}
+
+type InstrumentedController struct {
+	err error
+}
+
+func (c *InstrumentedController) Gen_Account() *Account {
+	return &Account{Name: "golazy"}
+}
+
+func (c *InstrumentedController) Before_Auth(a *Account) {}
+
+func (c *InstrumentedController) Index(ctx context.Context) (string, error) {
+	if ctx.Value(eventNameKey{}) != "Index" {
+		return "", errors.New("action context is not the instrumented one")
+	}
+	return "index", c.err
+}
+
+func (c *InstrumentedController) After_Log() {}
+
+func (c *InstrumentedController) HandleError(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
+func TestDispatcher_Instrument(t *testing.T) {
+	tests := []struct {
+		name       string
+		controller *InstrumentedController
+		events     []string
+	}{
+		{"Success", &InstrumentedController{}, []string{
+			"start request InstrumentedController#Index",
+			"start filter Before_Auth",
+			"start generator Gen_Account",
+			"finish generator Gen_Account",
+			"finish filter Before_Auth",
+			"start action Index",
+			"finish action Index",
+			"start after_filter After_Log",
+			"finish after_filter After_Log",
+			"finish request InstrumentedController#Index status=200",
+		}},
+		{"Error", &InstrumentedController{err: errors.New("boom")}, []string{
+			"start request InstrumentedController#Index",
+			"start filter Before_Auth",
+			"start generator Gen_Account",
+			"finish generator Gen_Account",
+			"finish filter Before_Auth",
+			"start action Index",
+			"start error_handler HandleError",
+			"finish error_handler HandleError err=boom",
+			"finish action Index err=boom",
+			"finish request InstrumentedController#Index err=boom status=500",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &recordingInstrumenter{t: t}
+			d := New()
+			d.Instrument(i)
+			d.Draw(func(r *Scope) {
+				r.Resources(tt.controller).Path("instrumented")
+			})
+
+			d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/instrumented", nil))
+			if !reflect.DeepEqual(i.events, tt.events) {
+				t.Errorf("expected events:\n%q\ngot:\n%q", tt.events, i.events)
+			}
+		})
+	}
+}
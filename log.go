@@ -0,0 +1,104 @@
+package lazydispatch
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Logger sets the logger used by the dispatcher.
+// Every served action is logged at debug level with its route, status and the
+// time spent in each filter, generator and in the action itself.
+// Draw logs its warnings at warn level.
+// By default only the warnings of Draw are logged, with slog.Default. It has to be set before calling Draw.
+//
+//	d.Logger(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})))
+func (d *Dispatcher) Logger(l *slog.Logger) {
+	d.logger = l
+}
+
+// warn logs a warning of Draw. They point to mistakes in the routes, so without
+// a Logger they go to slog.Default instead of being discarded.
+func (d *Dispatcher) warn(msg string, args ...any) {
+	logger := d.logger
+	if logger == discardLogger {
+		logger = slog.Default()
+	}
+	logger.Warn(msg, args...)
+}
+
+// discardLogger is the default logger. It doesn't log anything.
+var discardLogger = slog.New(discardHandler{})
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// logRequest logs the request served by the action with its timings
+func (t *tracker) logRequest(r *http.Request, w *statusRecorder) {
+	name := ""
+	if t.route != nil {
+		name = t.route.Name
+	}
+
+	t.actx.logger.LogAttrs(r.Context(), slog.LevelDebug, "action",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("route", name),
+		slog.String("target", t.target()),
+		slog.Int("status", w.status),
+		slog.Duration("duration", time.Since(t.start)),
+		slog.Group("timings", t.timings...),
+	)
+}
+
+// statusRecorder keeps the status code written to the response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusRecorder) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,62 @@
+package lazydispatch
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type LogsController struct {
+	BaseController
+}
+
+func (c *LogsController) Gen_PostParam() PostParam {
+	return PostParam("index")
+}
+
+func (c *LogsController) Index(p PostParam) {
+	c.out = string(p)
+}
+
+func TestDispatcher_Logger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	d := New()
+	d.Logger(slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	d.Draw(func(r *Scope) {
+		r.Resources(&LogsController{})
+	})
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/logs", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected code 200, got %d", w.Code)
+	}
+
+	out := buf.String()
+	for _, attr := range []string{
+		"level=DEBUG", "msg=action", "method=GET", "path=/logs", "route=logs",
+		"target=LogsController#Index", "status=200", "duration=",
+		"timings.Before_000_SetRequestResponse=", "timings.Gen_PostParam=", "timings.Index=", "timings.After_ZZZ_WriteOutput=",
+	} {
+		if !strings.Contains(out, attr) {
+			t.Errorf("expected log to contain %q, got %q", attr, out)
+		}
+	}
+}
+
+func TestDispatcher_LoggerInfo(t *testing.T) {
+	buf := &bytes.Buffer{}
+	d := New()
+	d.Logger(slog.New(slog.NewTextHandler(buf, nil)))
+	d.Draw(func(r *Scope) {
+		r.Resources(&LogsController{})
+	})
+
+	d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/logs", nil))
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing to be logged at info level, got %q", buf.String())
+	}
+}
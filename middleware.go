@@ -1,8 +1,96 @@
 package lazydispatch
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+	"slices"
+)
 
+// middleware is a middleware registered by name with UseNamed
 type middleware struct {
 	name string
-	m    http.Handler
+	m    func(http.Handler) http.Handler
+}
+
+// UseNamed appends a named middleware to the dispatcher.
+// Named middlewares run after the route is matched, in the order they were registered,
+// and can be disabled for some routes with Scope.SkipMiddleware or Scope.OnlyMiddleware:
+//
+//	d.UseNamed("auth", RequireUser)
+//	d.UseNamed("csrf", CheckCSRF)
+//	d.Draw(func(r *Scope) {
+//		r.Path("api").SkipMiddleware("csrf").Draw(func(api *Scope) {
+//			...
+//		})
+//	})
+//
+// It panics if the name is already registered.
+// All the named middlewares have to be setup before calling Draw
+func (d *Dispatcher) UseNamed(name string, m func(http.Handler) http.Handler) {
+	d.insertNamed(len(d.named), name, m)
+}
+
+// InsertBefore adds a named middleware that runs right before the one called other
+func (d *Dispatcher) InsertBefore(other, name string, m func(http.Handler) http.Handler) {
+	d.insertNamed(d.namedIndex(other), name, m)
+}
+
+// InsertAfter adds a named middleware that runs right after the one called other
+func (d *Dispatcher) InsertAfter(other, name string, m func(http.Handler) http.Handler) {
+	d.insertNamed(d.namedIndex(other)+1, name, m)
+}
+
+func (d *Dispatcher) namedIndex(name string) int {
+	i := slices.IndexFunc(d.named, func(mw middleware) bool { return mw.name == name })
+	if i == -1 {
+		panic(fmt.Errorf("middleware %q is not registered", name))
+	}
+	return i
+}
+
+func (d *Dispatcher) insertNamed(i int, name string, m func(http.Handler) http.Handler) {
+	if slices.ContainsFunc(d.named, func(mw middleware) bool { return mw.name == name }) {
+		panic(fmt.Errorf("middleware %q is already registered", name))
+	}
+	d.named = slices.Insert(d.named, i, middleware{name: name, m: m})
+}
+
+// namedFor returns the named middlewares that apply to the route
+func (d *Dispatcher) namedFor(route *Route) []middleware {
+	mws := []middleware{}
+	for _, mw := range d.named {
+		if route.OnlyMiddlewares != nil && !slices.Contains(route.OnlyMiddlewares, mw.name) {
+			continue
+		}
+		if slices.Contains(route.SkipMiddlewares, mw.name) {
+			continue
+		}
+		mws = append(mws, mw)
+	}
+	return mws
+}
+
+// checkNamed returns an error for the routes that skip or require unregistered middlewares
+func (d *Dispatcher) checkNamed(routes []*Route) error {
+	for _, route := range routes {
+		for _, name := range append(slices.Clone(route.SkipMiddlewares), route.OnlyMiddlewares...) {
+			if !slices.ContainsFunc(d.named, func(mw middleware) bool { return mw.name == name }) {
+				return fmt.Errorf("%s %s (%s): middleware %q is not registered", route.Method, route.URL, routeDescription(route), name)
+			}
+		}
+	}
+	return nil
+}
+
+// handlerFor wraps the route handler with the named middlewares and the middlewares of its scopes
+func (d *Dispatcher) handlerFor(route *Route) http.Handler {
+	h := route.chain()
+	named := d.namedFor(route)
+	for i := len(named) - 1; i >= 0; i-- {
+		h = named[i].m(h)
+	}
+	if route.implicitHead {
+		h = headHandler(h)
+	}
+	return h
 }
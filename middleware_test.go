@@ -1,9 +1,11 @@
 package lazydispatch
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -42,3 +44,137 @@ func expect2(t *testing.T, h http.Handler, verb, path string, body io.Reader, ex
 		t.Errorf("expected body %q, got %q", body, w.Body.String())
 	}
 }
+
+func routeName(r *http.Request) string {
+	if route := RouteFrom(r.Context()); route != nil {
+		return route.Name
+	}
+	return "none"
+}
+
+func TestMiddleware_Routed(t *testing.T) {
+	d := New()
+	seen := []string{}
+	d.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = append(seen, "use:"+routeName(r))
+			next.ServeHTTP(w, r)
+		})
+	})
+	d.UseRouted(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = append(seen, "routed:"+routeName(r))
+			next.ServeHTTP(w, r)
+		})
+	})
+	d.Draw(func(r *Scope) {
+		r.Get("/about").As("about").To(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(routeName(r)))
+		}))
+	})
+
+	expect2(t, d, "GET", "/about", nil, http.StatusOK, "about")
+	expect2(t, d, "GET", "/missing", nil, http.StatusNotFound, "Not Found")
+
+	expected := []string{"use:none", "routed:about", "use:none", "routed:none"}
+	if fmt.Sprint(seen) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, seen)
+	}
+}
+
+func TestMiddleware_Named(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	d := New()
+	d.UseNamed("auth", tag("auth"))
+	d.UseNamed("csrf", tag("csrf"))
+	d.InsertBefore("auth", "session", tag("session"))
+	d.InsertAfter("auth", "admin", tag("admin"))
+	d.Draw(func(r *Scope) {
+		r.Get("home").To(ok)
+		r.Path("api").SkipMiddleware("csrf", "session").Draw(func(api *Scope) {
+			api.Get("status").To(ok)
+			api.Resources(&PagesController{}).Path("pages").SkipMiddleware("admin")
+		})
+		r.Path("public").OnlyMiddleware("csrf").Draw(func(public *Scope) {
+			public.Get("about").To(ok)
+			public.Path("raw").OnlyMiddleware().Draw(func(raw *Scope) {
+				raw.Get("file").To(ok)
+			})
+		})
+		r.Resource(&SessionController{}).OnlyMiddleware("session", "csrf")
+	})
+
+	tests := map[string]string{
+		"/home":            "session auth admin csrf",
+		"/api/status":      "auth admin",
+		"/api/pages/1":     "auth",
+		"/public/about":    "csrf",
+		"/public/raw/file": "",
+		"/session":         "session csrf",
+	}
+	for path, expected := range tests {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected code %d, got %d", path, http.StatusOK, w.Code)
+		}
+		if got := strings.Join(w.Header().Values("X-Chain"), " "); got != expected {
+			t.Errorf("%s: expected chain %q, got %q", path, expected, got)
+		}
+	}
+
+	for _, info := range d.Inspect() {
+		if info.Path == "/api/status" && strings.Join(info.Middlewares, " ") != "auth admin" {
+			t.Errorf("expected inspect to list the named middlewares, got %v", info.Middlewares)
+		}
+	}
+}
+
+func TestMiddleware_NamedErrors(t *testing.T) {
+	expectPanic := func(contains string, fn func()) {
+		t.Helper()
+		defer func() {
+			t.Helper()
+			p := recover()
+			if p == nil || !strings.Contains(fmt.Sprint(p), contains) {
+				t.Errorf("expected a panic containing %q, got %v", contains, p)
+			}
+		}()
+		fn()
+	}
+
+	d := New()
+	d.UseNamed("auth", tag("auth"))
+	expectPanic(`middleware "auth" is already registered`, func() { d.UseNamed("auth", tag("auth")) })
+	expectPanic(`middleware "csrf" is not registered`, func() { d.InsertAfter("csrf", "session", tag("session")) })
+
+	expectPanic(`GET /home (handler http.HandlerFunc): middleware "csfr" is not registered`, func() {
+		d.Draw(func(r *Scope) {
+			r.Get("home").SkipMiddleware("csfr").To(http.NotFoundHandler())
+		})
+	})
+}
+
+func TestMiddleware_DrawAfterServe(t *testing.T) {
+	d := New()
+	d.UseNamed("auth", tag("auth"))
+	d.Draw(func(r *Scope) {
+		r.Get("home").To(text("home"))
+	})
+	expect2(t, d, "GET", "/home", nil, http.StatusOK, "home")
+
+	d.Draw(func(r *Scope) {
+		r.Get("about").To(text("about"))
+	})
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/about", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "about" {
+		t.Errorf("expected 200 %q, got %d %q", "about", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("X-Chain"); got != "auth" {
+		t.Errorf("expected chain %q, got %q", "auth", got)
+	}
+}
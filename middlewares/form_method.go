@@ -1,21 +1,67 @@
 package middlewares
 
 import (
+	"mime"
 	"net/http"
+	"strings"
 
 	"golazy.dev/lazysupport"
 )
 
 const FormMethodMiddleware = "form_method"
 
-var FormMethod = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-	if r.Method == "POST" {
-		// Be aware that FormValue will read the request body
-		method := r.FormValue("_method")
-		if validFormMethods.Has(method) {
-			r.Method = method
+// maxFormMemory is the memory used by FormMethod to parse multipart forms. The rest goes to temporary files
+const maxFormMemory = 32 << 20
+
+// FormMethod lets HTML forms and clients that can only send POST requests reach the PUT, PATCH
+// and DELETE routes. The method is taken from the X-HTTP-Method-Override header or, for
+// urlencoded and multipart bodies, from the _method form field.
+//
+// It has to run before routing, so it is added with Dispatcher.Use:
+//
+//	d.Use(middlewares.FormMethod)
+//
+// The form is parsed only once, so the action still finds it in r.Form and r.PostForm.
+func FormMethod(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method := r.Header.Get("X-HTTP-Method-Override")
+		if method == "" {
+			method = formMethod(r)
+		}
+		method = strings.ToUpper(method)
+		if !validFormMethods.Has(method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.Method = method
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// formMethod returns the _method field of urlencoded and multipart bodies
+func formMethod(r *http.Request) string {
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch ct {
+	case "application/x-www-form-urlencoded":
+		if r.ParseForm() != nil {
+			return ""
+		}
+	case "multipart/form-data":
+		if r.ParseMultipartForm(maxFormMemory) != nil {
+			return ""
 		}
+	default:
+		return ""
 	}
-})
+	return r.PostForm.Get("_method")
+}
 
 var validFormMethods = lazysupport.NewStringSet("PUT", "PATCH", "DELETE")
@@ -0,0 +1,111 @@
+package middlewares
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golazy.dev/lazydispatch"
+)
+
+type ArticlesController struct{}
+
+func (c *ArticlesController) Show(id string) string {
+	return "show " + id
+}
+
+func (c *ArticlesController) Create(r *http.Request) string {
+	return "create " + r.PostForm.Get("title")
+}
+
+func (c *ArticlesController) Update(r *http.Request, id string) string {
+	return r.Method + " " + id + " " + r.PostForm.Get("title")
+}
+
+func (c *ArticlesController) Delete(id string) string {
+	return "delete " + id
+}
+
+func TestFormMethod(t *testing.T) {
+	d := lazydispatch.New()
+	d.Use(FormMethod)
+	d.Draw(func(r *lazydispatch.Scope) {
+		r.Resources(&ArticlesController{}).Path("articles")
+	})
+
+	multipartBody := func(fields map[string]string) (string, *bytes.Buffer) {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		for k, v := range fields {
+			mw.WriteField(k, v)
+		}
+		mw.Close()
+		return mw.FormDataContentType(), body
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		header  string
+		body    func() (string, *bytes.Buffer)
+		code    int
+		expBody string
+	}{
+		{name: "urlencoded put", path: "/articles/1", body: func() (string, *bytes.Buffer) {
+			return "application/x-www-form-urlencoded", bytes.NewBufferString("_method=put&title=hello")
+		}, code: 200, expBody: "PUT 1 hello"},
+		{name: "urlencoded patch", path: "/articles/1", body: func() (string, *bytes.Buffer) {
+			return "application/x-www-form-urlencoded", bytes.NewBufferString("_method=PATCH&title=hi")
+		}, code: 200, expBody: "PATCH 1 hi"},
+		{name: "multipart delete", path: "/articles/2", body: func() (string, *bytes.Buffer) {
+			return multipartBody(map[string]string{"_method": "DELETE"})
+		}, code: 200, expBody: "delete 2"},
+		{name: "header", path: "/articles/3", header: "DELETE", body: func() (string, *bytes.Buffer) {
+			return "application/json", bytes.NewBufferString(`{}`)
+		}, code: 200, expBody: "delete 3"},
+		{name: "json body is not read", path: "/articles/4", body: func() (string, *bytes.Buffer) {
+			return "application/json", bytes.NewBufferString(`_method=DELETE`)
+		}, code: 405, expBody: "Method Not Allowed"},
+		{name: "invalid method", path: "/articles/5", body: func() (string, *bytes.Buffer) {
+			return "application/x-www-form-urlencoded", bytes.NewBufferString("_method=GET")
+		}, code: 405, expBody: "Method Not Allowed"},
+		{name: "plain post", path: "/articles", body: func() (string, *bytes.Buffer) {
+			return "application/x-www-form-urlencoded", bytes.NewBufferString("title=new")
+		}, code: 200, expBody: "create new"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ct, body := tt.body()
+			r := httptest.NewRequest("POST", tt.path, body)
+			r.Header.Set("Content-Type", ct)
+			if tt.header != "" {
+				r.Header.Set("X-HTTP-Method-Override", tt.header)
+			}
+			w := httptest.NewRecorder()
+			d.ServeHTTP(w, r)
+			if w.Code != tt.code {
+				t.Errorf("expected code %d, got %d", tt.code, w.Code)
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.expBody {
+				t.Errorf("expected body %q, got %q", tt.expBody, got)
+			}
+		})
+	}
+}
+
+func TestFormMethod_OnlyPost(t *testing.T) {
+	h := FormMethod(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method))
+	}))
+	r := httptest.NewRequest("GET", "/articles/1", nil)
+	r.Header.Set("X-HTTP-Method-Override", "DELETE")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Body.String() != "GET" {
+		t.Errorf("expected GET requests to keep their method, got %q", w.Body.String())
+	}
+}
@@ -0,0 +1,230 @@
+package middlewares
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golazy.dev/lazydispatch"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the request duration histogram
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics counts the requests served by each route and measures their latency.
+// The series are labeled by the matched route (name, target and method) instead
+// of the raw path, so the number of series is bounded by the number of routes.
+// Requests that match no route have empty route and target labels and the "other" method.
+//
+// Its Middleware has to run after routing, so it is added with UseRouted.
+// Metrics is also an http.Handler that serves the metrics in the Prometheus
+// text exposition format:
+//
+//	metrics := middlewares.NewMetrics()
+//	d.UseRouted(metrics.Middleware)
+//	d.Draw(func(r *lazydispatch.Scope) {
+//		r.Get("/metrics").To(metrics)
+//	})
+type Metrics struct {
+	buckets []float64
+	mu      sync.Mutex
+	series  map[routeLabels]*routeSeries
+}
+
+type routeLabels struct {
+	method, route, target string
+}
+
+type routeSeries struct {
+	requests map[string]uint64 // requests by status class
+	buckets  []uint64
+	sum      float64
+	count    uint64
+}
+
+// NewMetrics returns a Metrics with the given histogram buckets, or DefaultBuckets if none is given
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	return &Metrics{
+		buckets: buckets,
+		series:  map[routeLabels]*routeSeries{},
+	}
+}
+
+// Middleware records every request with the route from lazydispatch.RouteFrom and the status
+// of the response. Panics are recorded with the status of the error, 500 by default, and go on.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		labels := routeLabels{method: "other"}
+		if route := lazydispatch.RouteFrom(r.Context()); route != nil {
+			labels.method, labels.route, labels.target = route.Method, route.Name, route.Target
+		}
+		defer func() {
+			p := recover()
+			status := sw.status
+			if p != nil && status == 0 {
+				err, _ := p.(error)
+				status = lazydispatch.StatusCode(err)
+			}
+			if status == 0 {
+				status = http.StatusOK
+			}
+			m.record(labels, status, time.Since(start))
+			if p != nil {
+				panic(p)
+			}
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// record adds a finished request to the series of its labels
+func (m *Metrics) record(labels routeLabels, status int, duration time.Duration) {
+	seconds := duration.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.series[labels]
+	if !ok {
+		s = &routeSeries{
+			requests: map[string]uint64{},
+			buckets:  make([]uint64, len(m.buckets)),
+		}
+		m.series[labels] = s
+	}
+	s.requests[statusClass(status)]++
+	for i, le := range m.buckets {
+		if seconds <= le {
+			s.buckets[i]++
+		}
+	}
+	s.sum += seconds
+	s.count++
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(m.String()))
+}
+
+// String returns the metrics in the Prometheus text exposition format
+func (m *Metrics) String() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]routeLabels, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].target != keys[j].target {
+			return keys[i].target < keys[j].target
+		}
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].method < keys[j].method
+	})
+
+	b := &strings.Builder{}
+	fmt.Fprintln(b, "# HELP lazydispatch_requests_total Number of requests served by route and status class.")
+	fmt.Fprintln(b, "# TYPE lazydispatch_requests_total counter")
+	for _, k := range keys {
+		s := m.series[k]
+		classes := make([]string, 0, len(s.requests))
+		for class := range s.requests {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			fmt.Fprintf(b, "lazydispatch_requests_total{%s,status_class=%q} %d\n", k.String(), class, s.requests[class])
+		}
+	}
+
+	fmt.Fprintln(b, "# HELP lazydispatch_request_duration_seconds Time spent serving the requests by route.")
+	fmt.Fprintln(b, "# TYPE lazydispatch_request_duration_seconds histogram")
+	for _, k := range keys {
+		s := m.series[k]
+		for i, le := range m.buckets {
+			fmt.Fprintf(b, "lazydispatch_request_duration_seconds_bucket{%s,le=%q} %d\n", k.String(), strconv.FormatFloat(le, 'g', -1, 64), s.buckets[i])
+		}
+		fmt.Fprintf(b, "lazydispatch_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", k.String(), s.count)
+		fmt.Fprintf(b, "lazydispatch_request_duration_seconds_sum{%s} %s\n", k.String(), strconv.FormatFloat(s.sum, 'g', -1, 64))
+		fmt.Fprintf(b, "lazydispatch_request_duration_seconds_count{%s} %d\n", k.String(), s.count)
+	}
+	return b.String()
+}
+
+func (l routeLabels) String() string {
+	return fmt.Sprintf("method=\"%s\",route=\"%s\",target=\"%s\"", escapeLabel(l.method), escapeLabel(l.route), escapeLabel(l.target))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+// statusWriter records the status of the response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// statusClass returns "2xx" for 200, "4xx" for 404...
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%dxx", status/100)
+}
@@ -0,0 +1,119 @@
+package middlewares
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golazy.dev/lazydispatch"
+)
+
+type PostsController struct{}
+
+func (c *PostsController) Index() string {
+	return "index"
+}
+
+func (c *PostsController) Show(id string) error {
+	if id == "missing" {
+		return errors.New("not found")
+	}
+	return nil
+}
+
+func (c *PostsController) HandleError(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics(0.1, 1)
+	d := lazydispatch.New()
+	d.UseRouted(metrics.Middleware)
+	d.Draw(func(r *lazydispatch.Scope) {
+		r.Resources(&PostsController{}).Path("posts")
+		r.Get("/health").As("health").To(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+		r.Get("/crash").As("crash").To(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))
+		r.Get("/metrics").To(metrics)
+	})
+
+	for _, path := range []string{"/posts", "/posts", "/posts/1", "/posts/missing", "/health", "/nowhere", "/crash"} {
+		d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/health", nil))
+	d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("RANDOM123", "/health", nil))
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	out := w.Body.String()
+	for _, line := range []string{
+		"# TYPE lazydispatch_requests_total counter",
+		`lazydispatch_requests_total{method="GET",route="posts",target="PostsController#Index",status_class="2xx"} 2`,
+		`lazydispatch_requests_total{method="GET",route="post",target="PostsController#Show",status_class="2xx"} 1`,
+		`lazydispatch_requests_total{method="GET",route="post",target="PostsController#Show",status_class="4xx"} 1`,
+		`lazydispatch_requests_total{method="GET",route="health",target="",status_class="2xx"} 1`,
+		`lazydispatch_requests_total{method="GET",route="crash",target="",status_class="5xx"} 1`,
+		`lazydispatch_requests_total{method="other",route="",target="",status_class="4xx"} 3`,
+		"# TYPE lazydispatch_request_duration_seconds histogram",
+		`lazydispatch_request_duration_seconds_bucket{method="GET",route="posts",target="PostsController#Index",le="0.1"} 2`,
+		`lazydispatch_request_duration_seconds_bucket{method="GET",route="posts",target="PostsController#Index",le="+Inf"} 2`,
+		`lazydispatch_request_duration_seconds_count{method="GET",route="post",target="PostsController#Show"} 2`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("expected metrics to contain %q, got:\n%s", line, out)
+		}
+	}
+	if strings.Contains(out, "RANDOM123") {
+		t.Errorf("expected the methods of unmatched requests to be grouped, got:\n%s", out)
+	}
+}
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (w *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return nil, nil, nil
+}
+
+func TestMetrics_Hijack(t *testing.T) {
+	metrics := NewMetrics()
+	d := lazydispatch.New()
+	d.UseRouted(metrics.Middleware)
+	d.Draw(func(r *lazydispatch.Scope) {
+		r.Get("/ws").As("ws").To(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, _, err := w.(http.Hijacker).Hijack(); err != nil {
+				t.Error(err)
+			}
+		}))
+	})
+
+	w := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/ws", nil))
+	if !w.hijacked {
+		t.Error("expected the connection to be hijacked")
+	}
+	if out := metrics.String(); !strings.Contains(out, `method="GET",route="ws",target="",status_class="1xx"} 1`) {
+		t.Errorf("expected the upgrade to be recorded, got:\n%s", out)
+	}
+}
+
+func TestMetrics_EscapeLabels(t *testing.T) {
+	l := routeLabels{method: "GET", route: `a"b`, target: "c\\d\ne"}
+	if l.String() != `method="GET",route="a\"b",target="c\\d\ne"` {
+		t.Errorf("unexpected labels %s", l.String())
+	}
+}
@@ -1,16 +1,24 @@
 package middlewares
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"html/template"
+	"net"
 	"net/http"
-	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
 
+	"golazy.dev/lazydispatch"
+	"golazy.dev/lazysupport"
 	"golazy.dev/lazysupport/rrrecorder"
 
 	"github.com/timewasted/go-accept-headers"
@@ -18,96 +26,245 @@ import (
 
 const NicePanicsMiddleware = "nice_panics"
 
-var NicePanics = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-	// Does the recorder supports this request?
-	if !rrrecorder.IsRecordable(r) {
-		return
-	}
-
-	// Does the client accept HTML?
-	t, _ := accept.Negotiate(r.Header.Get("Accept"), "text/html")
-	if t == "" {
-		//dispatcher.Next(w, r)
-		return
-	}
+// Production disables NicePanics. It is true when the GO_ENV environment variable is "production"
+var Production = os.Getenv("GO_ENV") == "production"
 
-	rec := httptest.NewRecorder()
+// sourceContext is the number of lines shown before and after the line of an app frame
+const sourceContext = 4
 
-	defer func() {
-		if err := recover(); err != nil {
-			w.Header().Del("Content-Length")
-			w.WriteHeader(http.StatusInternalServerError)
-			s := StackDecode(debug.Stack())
+// NicePanics is a development middleware that catches panics and shows where they happened.
+// HTML clients get a page with the stack, the source around the application frames, the request
+// and the matched route. Other clients get the same information as JSON or plain text, depending
+// on the Accept header.
+//
+// It is registered after routing so the matched route is known:
+//
+//	d.UseNamed(middlewares.NicePanicsMiddleware, middlewares.NicePanics)
+//
+// It does nothing when Production is set, or when the response was already started.
+func NicePanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Does the recorder supports this request?
+		if Production || !rrrecorder.IsRecordable(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-			p := Panic{
-				Reason:     err,
-				Stacktrace: s,
+		pw := &panicWriter{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
 			}
+			if p == http.ErrAbortHandler || pw.wrote {
+				panic(p)
+			}
+			newPanic(p, debug.Stack(), r).write(w, r)
+		}()
+		next.ServeHTTP(pw, r)
+	})
+}
 
-			fmt.Println(p.String())
-			w.Write([]byte(p.String()))
+// Panic describes a recovered panic
+type Panic struct {
+	Reason     any
+	Stacktrace []StackLine
+	Request    *http.Request
+	Route      *lazydispatch.Route
+}
 
-		} else {
-			for k, v := range rec.Header() {
-				for _, v := range v {
-					w.Header().Add(k, v)
-				}
-			}
-			w.WriteHeader(rec.Code)
-			io.Copy(w, rec.Body)
+func newPanic(p any, stack []byte, r *http.Request) Panic {
+	lines := StackDecode(stack)
+	// Skip the frames of the recovery
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i].Package == "runtime" && lines[i].Func == "panic" {
+			lines = lines[i+1:]
+			break
+		}
+	}
+	for i := range lines {
+		if lines[i].App() {
+			lines[i].Source = source(lines[i].File, lines[i].LineNumber())
 		}
-	}()
+	}
+	return Panic{
+		Reason:     p,
+		Stacktrace: lines,
+		Request:    r,
+		Route:      lazydispatch.RouteFrom(r.Context()),
+	}
+}
 
-	// Create new recorder
-	//	dispatcher.Next(rec, r)
-})
+// Kind returns a short description of the panic value
+func (p Panic) Kind() string {
+	if err, ok := p.Reason.(error); ok {
+		var pa *lazysupport.Panic
+		if errors.As(err, &pa) {
+			return "panic in action"
+		}
+		return fmt.Sprintf("panic (%T)", err)
+	}
+	return fmt.Sprintf("panic (%T)", p.Reason)
+}
 
-var funcReg = regexp.MustCompile(`(created by )?(.*\/[^\.]+)\.((\(\*?\w+\))?[^\(]*)(\(.*\))?$`)
-var fileReg = regexp.MustCompile(`([\/\w\.\@]+):(\d+)`)
+// Message returns the panic value as a string
+func (p Panic) Message() string {
+	if err, ok := p.Reason.(error); ok {
+		return err.Error()
+	}
+	return fmt.Sprint(p.Reason)
+}
 
-func StackDecode(data []byte) (sls []StackLine) {
+func (p Panic) write(w http.ResponseWriter, r *http.Request) {
+	t, _ := accept.Negotiate(r.Header.Get("Accept"), "text/plain", "text/html", "application/json")
 
-	lines := strings.Split(string(data), "\n")[7:]
-	for i := 0; i < len(lines); i += 2 {
+	w.Header().Del("Content-Length")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	switch t {
+	case "text/html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		panicTemplate.Execute(w, p)
+	case "application/json":
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(p.jsonValue())
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(p.String()))
+	}
+}
 
-		sl := StackLine{
-			L: i,
+func (p Panic) jsonValue() map[string]any {
+	stack := []map[string]any{}
+	for _, sl := range p.Stacktrace {
+		stack = append(stack, map[string]any{
+			"package": sl.Package,
+			"func":    sl.Func,
+			"file":    sl.File,
+			"line":    sl.LineNumber(),
+			"app":     sl.App(),
+		})
+	}
+	v := map[string]any{
+		"error": p.Message(),
+		"kind":  p.Kind(),
+		"stack": stack,
+	}
+	if p.Request != nil {
+		v["request"] = map[string]any{
+			"method": p.Request.Method,
+			"url":    p.Request.URL.String(),
 		}
-		s := funcReg.FindStringSubmatch(lines[i])
-		if len(s) != 6 {
-			continue
-		} else {
-			sl.Package = s[2]
-			sl.Func = s[3]
-
-			if i := strings.LastIndex(sl.Func, "."); i != -1 {
-				sl.Func = sl.Func[:i] + " " + sl.Func[i+1:]
-			}
-			sl.Func = sl.Func
+	}
+	if p.Route != nil {
+		v["route"] = map[string]any{
+			"name":   p.Route.Name,
+			"method": p.Route.Method,
+			"url":    p.Route.URL,
+			"target": p.Route.Target,
 		}
+	}
+	return v
+}
 
-		if len(lines) > i+1 {
-			l := fileReg.FindStringSubmatch(lines[i+1])
-			sl.Line = fmt.Sprint(l)
-			if len(l) == 3 {
-				sl.File = l[1]
-				sl.Line = l[2]
-			} else {
-				sl.File = lines[i+1]
-			}
+// Headers returns the request headers sorted by name
+func (p Panic) Headers() [][2]string {
+	headers := [][2]string{}
+	if p.Request == nil {
+		return headers
+	}
+	for k, vs := range p.Request.Header {
+		for _, v := range vs {
+			headers = append(headers, [2]string{k, v})
+		}
+	}
+	sort.Slice(headers, func(i, j int) bool { return headers[i][0] < headers[j][0] })
+	return headers
+}
 
+func (p Panic) String() string {
+	s := fmt.Sprintf("%s: %s\n", p.Kind(), p.Message())
+	if p.Request != nil {
+		s += fmt.Sprintf("request: %s %s\n", p.Request.Method, p.Request.URL)
+	}
+	if p.Route != nil {
+		s += fmt.Sprintf("route: %s %s (%s)\n", p.Route.Method, p.Route.URL, p.Route.Target)
+	}
+	s += "\n"
+	for _, sl := range p.Stacktrace {
+		file := sl.File
+		if rel, err := filepath.Rel(path, file); err == nil && sl.App() {
+			file = rel
 		}
+		s += fmt.Sprintf("%-55s %s\n", file+":"+sl.Line, sl.Func)
+	}
+	return s
+}
 
-		sls = append(sls, sl)
+var fileReg = regexp.MustCompile(`^\s*(.+):(\d+)(?: \+0x[0-9a-f]+)?$`)
+
+// StackDecode parses the output of debug.Stack
+func StackDecode(data []byte) (sls []StackLine) {
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "goroutine ") {
+		lines = lines[1:]
 	}
 
+	for i := 0; i+1 < len(lines); i += 2 {
+		if strings.HasPrefix(lines[i], "...") {
+			i--
+			continue
+		}
+		sl := StackLine{L: i}
+		sl.Package, sl.Func = decodeFunc(lines[i])
+		if l := fileReg.FindStringSubmatch(lines[i+1]); len(l) == 3 {
+			sl.File = l[1]
+			sl.Line = l[2]
+		} else {
+			sl.File = strings.TrimSpace(lines[i+1])
+		}
+		sls = append(sls, sl)
+	}
 	return
-
 }
 
-type Panic struct {
-	Reason     any
-	Stacktrace []StackLine
+// decodeFunc splits a stack function line like "golazy.dev/app.(*PostsController).Show(0x1)"
+// into its package and its function "(*PostsController) Show"
+func decodeFunc(line string) (pkg, fn string) {
+	line = strings.TrimPrefix(line, "created by ")
+	if i := strings.Index(line, " in goroutine "); i != -1 {
+		line = line[:i]
+	}
+	// Remove the arguments
+	if strings.HasSuffix(line, ")") {
+		depth := 0
+		for i := len(line) - 1; i >= 0; i-- {
+			switch line[i] {
+			case ')':
+				depth++
+			case '(':
+				depth--
+			}
+			if depth == 0 {
+				line = line[:i]
+				break
+			}
+		}
+	}
+
+	slash := strings.LastIndex(line, "/") + 1
+	dot := strings.Index(line[slash:], ".")
+	if dot == -1 {
+		// Builtins like panic are shown without package
+		return "runtime", line
+	}
+	pkg, fn = line[:slash+dot], line[slash+dot+1:]
+	if i := strings.LastIndex(fn, "."); i != -1 {
+		fn = fn[:i] + " " + fn[i+1:]
+	}
+	return pkg, fn
 }
 
 type StackLine struct {
@@ -116,33 +273,138 @@ type StackLine struct {
 	Func    string
 	File    string
 	Line    string
+	Source  []SourceLine // Source has the code around Line for the app frames
 }
 
-const (
-	maxLines = 5
-)
+// SourceLine is a line of code shown around a stack frame
+type SourceLine struct {
+	Number  int
+	Code    string
+	Current bool
+}
 
-func init() {
-	path, _ = os.Getwd()
+// App reports if the frame belongs to the application instead of the Go runtime or the dependencies
+func (sl StackLine) App() bool {
+	if path == "" || !strings.HasPrefix(sl.File, path+string(filepath.Separator)) {
+		return false
+	}
+	return !strings.HasPrefix(sl.File, runtime.GOROOT()) && !strings.Contains(sl.File, "/pkg/mod/")
 }
 
-var path = ""
+// LineNumber returns the line as a number
+func (sl StackLine) LineNumber() int {
+	n, _ := strconv.Atoi(sl.Line)
+	return n
+}
 
-func (p Panic) String() string {
-	s := fmt.Sprintf("panic: %s\n", p.Reason)
-	if len(p.Stacktrace) > maxLines {
-		p.Stacktrace = p.Stacktrace[:maxLines]
+func (sl StackLine) String() string {
+	return fmt.Sprintf("%3d: %40q %45q\t%s:%s\t", sl.L, sl.Package, sl.Func, sl.File, sl.Line)
+}
+
+// source reads the lines around line from file
+func source(file string, line int) []SourceLine {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
 	}
+	defer f.Close()
 
-	for _, sl := range p.Stacktrace {
-		file := sl.File
-		file, _ = filepath.Rel(path, file)
+	lines := []SourceLine{}
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan() && n <= line+sourceContext; n++ {
+		if n >= line-sourceContext {
+			lines = append(lines, SourceLine{Number: n, Code: s.Text(), Current: n == line})
+		}
+	}
+	return lines
+}
 
-		s += fmt.Sprintf("%-55s %s\n", file+":"+sl.Line, sl.Func)
+// panicWriter records if the response was started
+type panicWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *panicWriter) WriteHeader(code int) {
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *panicWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *panicWriter) Flush() {
+	w.wrote = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
 	}
-	return s
 }
 
-func (sl StackLine) String() string {
-	return fmt.Sprintf("%3d: %40q %45q\t%s:%s\t", sl.L, sl.Package, sl.Func, sl.File, sl.Line)
+func (w *panicWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	w.wrote = true
+	return h.Hijack()
 }
+
+func (w *panicWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func init() {
+	path, _ = os.Getwd()
+}
+
+var path = ""
+
+var panicTemplate = template.Must(template.New("panic").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Kind}}: {{.Message}}</title>
+<style>
+body { font-family: -apple-system, sans-serif; margin: 0; color: #222; }
+header { background: #c52f24; color: #fff; padding: 1em 2em; }
+header h1 { margin: 0; font-size: 1.2em; }
+header p { margin: .5em 0 0; font-family: monospace; white-space: pre-wrap; font-size: 1.1em; }
+section { padding: 0 2em; }
+table { border-collapse: collapse; font-family: monospace; }
+td { padding: .1em 1em .1em 0; vertical-align: top; }
+.frame { margin: 1em 0; }
+.frame.dep { color: #888; margin: .2em 0; }
+.frame .func { font-weight: bold; }
+.frame .file { font-family: monospace; }
+pre { background: #f6f6f6; margin: .5em 0; padding: .5em 0; overflow-x: auto; }
+pre .current { background: #fce1df; display: block; }
+pre .n { color: #999; display: inline-block; width: 4em; text-align: right; padding-right: 1em; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Kind}}{{with .Route}} in {{.Target}}{{end}}</h1>
+<p>{{.Message}}</p>
+</header>
+<section>
+<h2>Request</h2>
+<table>
+{{with .Request}}<tr><td>{{.Method}}</td><td>{{.URL}}</td></tr>{{end}}
+{{with .Route}}<tr><td>Route</td><td>{{.Method}} {{.URL}}{{with .Name}} ({{.}}){{end}}</td></tr>
+{{with .Target}}<tr><td>Target</td><td>{{.}}</td></tr>{{end}}{{end}}
+{{range .Headers}}<tr><td>{{index . 0}}</td><td>{{index . 1}}</td></tr>
+{{end}}
+</table>
+<h2>Stack</h2>
+{{range .Stacktrace}}{{if .App}}<div class="frame">
+<div><span class="func">{{.Func}}</span> <span class="file">{{.File}}:{{.Line}}</span></div>
+{{if .Source}}<pre>{{range .Source}}<span{{if .Current}} class="current"{{end}}><span class="n">{{.Number}}</span>{{.Code}}</span>
+{{end}}</pre>{{end}}
+</div>{{else}}<div class="frame dep"><span class="func">{{.Package}}.{{.Func}}</span> <span class="file">{{.File}}:{{.Line}}</span></div>
+{{end}}{{end}}
+</section>
+</body>
+</html>
+`))
@@ -0,0 +1,200 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golazy.dev/lazydispatch"
+)
+
+type CrashesController struct{}
+
+func (c *CrashesController) Show(id string) string {
+	if id == "error" {
+		panic(http.ErrNoCookie)
+	}
+	panic("crash " + id)
+}
+
+func crashDispatcher() *lazydispatch.Dispatcher {
+	d := lazydispatch.New()
+	d.UseNamed(NicePanicsMiddleware, NicePanics)
+	d.Draw(func(r *lazydispatch.Scope) {
+		r.Resources(&CrashesController{}).Path("crashes")
+		r.Get("started").To(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			panic("too late")
+		}))
+	})
+	return d
+}
+
+func crash(t *testing.T, d http.Handler, path, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", path, nil)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	d.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected code %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	return w
+}
+
+func TestNicePanics_HTML(t *testing.T) {
+	w := crash(t, crashDispatcher(), "/crashes/1", "text/html,application/xhtml+xml,*/*;q=0.8")
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	body := w.Body.String()
+	for _, s := range []string{
+		"crash 1",
+		"in CrashesController#Show",
+		"GET /crashes/:",
+		"/crashes/1",
+		"nice_panics_test.go:",
+		`class="current"><span class="n">`,
+		`panic(&#34;crash &#34; &#43; id)`,
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("expected the page to contain %q:\n%s", s, body)
+		}
+	}
+}
+
+func TestNicePanics_JSON(t *testing.T) {
+	w := crash(t, crashDispatcher(), "/crashes/error", "application/json")
+	v := struct {
+		Error string
+		Route struct{ Target string }
+		Stack []struct {
+			File string
+			App  bool
+		}
+	}{}
+	if err := json.NewDecoder(w.Body).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(v.Error, http.ErrNoCookie.Error()) {
+		t.Errorf("unexpected error %q", v.Error)
+	}
+	if v.Route.Target != "CrashesController#Show" {
+		t.Errorf("unexpected route target %q", v.Route.Target)
+	}
+	if len(v.Stack) == 0 || !v.Stack[0].App || !strings.HasSuffix(v.Stack[0].File, "nice_panics_test.go") {
+		t.Errorf("expected the stack to start in the action, got %+v", v.Stack)
+	}
+}
+
+func TestNicePanics_Text(t *testing.T) {
+	w := crash(t, crashDispatcher(), "/crashes/2", "")
+	body := w.Body.String()
+	if !strings.HasPrefix(body, "panic in action: ") || !strings.Contains(body, "crash 2") {
+		t.Errorf("unexpected body:\n%s", body)
+	}
+	if !strings.Contains(body, "nice_panics_test.go:") {
+		t.Errorf("expected the app frames to be relative to the working dir:\n%s", body)
+	}
+}
+
+func TestNicePanics_Skipped(t *testing.T) {
+	d := crashDispatcher()
+
+	// The response was started, so the dispatcher only logs the panic
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/started", nil))
+	if w.Code != http.StatusAccepted || w.Body.Len() != 0 {
+		t.Errorf("expected the started response to be kept, got %d %q", w.Code, w.Body.String())
+	}
+
+	Production = true
+	defer func() { Production = false }()
+	w = crash(t, d, "/crashes/1", "text/html")
+	if w.Body.String() != "Internal Server Error" {
+		t.Errorf("expected the default error page in production, got %q", w.Body.String())
+	}
+}
+
+type TicketsController struct{}
+
+func (c *TicketsController) Show(id int) (string, error) {
+	if id == 0 {
+		return "", lazydispatch.NotFound(errors.New("no ticket 0"))
+	}
+	return "ticket " + strconv.Itoa(id), nil
+}
+
+func TestNicePanics_HTTPErrors(t *testing.T) {
+	d := lazydispatch.New()
+	d.UseNamed(NicePanicsMiddleware, NicePanics)
+	d.Draw(func(r *lazydispatch.Scope) {
+		r.Resources(&TicketsController{}).Path("tickets")
+		r.Resources(&CrashesController{}).Path("crashes")
+	})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/tickets/1", http.StatusOK, "ticket 1"},
+		{"/tickets/0", http.StatusNotFound, "Not Found"},
+		{"/tickets/abc", http.StatusNotFound, "Not Found"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", tt.path, nil)
+		r.Header.Set("Accept", "text/html")
+		d.ServeHTTP(w, r)
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("GET %s: expected %d %q, got %d %q", tt.path, tt.code, tt.body, w.Code, w.Body.String())
+		}
+	}
+	if w := crash(t, d, "/crashes/1", "text/html"); !strings.Contains(w.Body.String(), "crash 1") {
+		t.Errorf("expected the panics to still get the page, got %q", w.Body.String())
+	}
+}
+
+func TestNicePanics_Hijack(t *testing.T) {
+	d := lazydispatch.New()
+	d.UseNamed(NicePanicsMiddleware, NicePanics)
+	d.Draw(func(r *lazydispatch.Scope) {
+		r.Get("ws").To(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, _, err := w.(http.Hijacker).Hijack(); err != nil {
+				t.Error(err)
+			}
+		}))
+	})
+
+	w := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/ws", nil))
+	if !w.hijacked {
+		t.Error("expected the connection to be hijacked")
+	}
+}
+
+func TestStackDecode(t *testing.T) {
+	lines := StackDecode(debug.Stack())
+	if len(lines) < 2 {
+		t.Fatalf("expected some lines, got %v", lines)
+	}
+	if lines[0].Package != "runtime/debug" || lines[0].Func != "Stack" {
+		t.Errorf("unexpected first frame %+v", lines[0])
+	}
+	if lines[1].Package != "golazy.dev/lazydispatch/middlewares" || lines[1].Func != "TestStackDecode" || lines[1].LineNumber() == 0 {
+		t.Errorf("unexpected second frame %+v", lines[1])
+	}
+
+	pkg, fn := decodeFunc("golazy.dev/app.(*PostsController).Show(0xc000010000, {0x1, 0x2})")
+	if pkg != "golazy.dev/app" || fn != "(*PostsController) Show" {
+		t.Errorf("unexpected decode %q %q", pkg, fn)
+	}
+}
@@ -22,7 +22,20 @@ func (nr *namedRoutes) Add(route Route) {
 	nr.routes = append(nr.routes, route)
 }
 
+// PathFor returns the path of a route. Routes restricted to a host get an absolute URL.
 func (nr *namedRoutes) PathFor(details ...any) string {
+	r, subdomain, path := nr.find(details...)
+	if r.Subdomain == "" {
+		return r.origin() + path
+	}
+	route := *r
+	route.Subdomain = subdomain
+	return route.origin() + path
+}
+
+// find returns the route for the arguments of PathFor, its subdomain and its path.
+// The values of the subdomain parameters come before the ones of the path.
+func (nr *namedRoutes) find(details ...any) (*Route, string, string) {
 	args := details
 	if len(args) == 0 {
 		panic("PathFor requires at least one argument")
@@ -58,11 +71,12 @@ func (nr *namedRoutes) PathFor(details ...any) string {
 		panic(fmt.Sprintf("path not found for %v", info))
 	}
 
-	if len(args) != countRequiredParams(r.Path) {
-		panic(fmt.Sprintf("path name %q requires %d arguments. Got %d", r.Name, countRequiredParams(r.Path), len(args)))
+	nSubdomain := len(subdomainParams(r.Subdomain))
+	if required := nSubdomain + countRequiredParams(r.Path); len(args) != required {
+		panic(fmt.Sprintf("path name %q requires %d arguments. Got %d", r.Name, required, len(args)))
 	}
 
-	return buildRoute(r, args...)
+	return r, buildSubdomain(r.Subdomain, args[:nSubdomain]...), buildRoute(r, args[nSubdomain:]...)
 }
 
 func countRequiredParams(path string) int {
@@ -93,6 +107,22 @@ func buildRoute(r *Route, params ...any) string {
 	return strings.Join(segments, "/")
 }
 
+// buildSubdomain replaces the :params of the subdomain with the ids of params
+func buildSubdomain(subdomain string, params ...any) string {
+	if subdomain == "" {
+		return ""
+	}
+	labels := strings.Split(subdomain, ".")
+	paramI := 0
+	for i, l := range labels {
+		if isParam(l) {
+			labels[i] = getID(params[paramI])
+			paramI++
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
 func getID(a any) string {
 	id, err := lazysupport.IDFor(a)
 	if err != nil {
@@ -0,0 +1,119 @@
+// Package otel traces the requests served by lazydispatch actions with OpenTelemetry.
+//
+// It opens a server span per request, named after the matched route, and a
+// child span for each filter, generator, action and error handler:
+//
+//	d := lazydispatch.New()
+//	d.Instrument(otel.New())
+//	d.Draw(func(r *lazydispatch.Scope) {
+//		r.Resources(&PostsController{})
+//	})
+package otel
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"golazy.dev/lazydispatch"
+)
+
+// ScopeName is the instrumentation scope name of the tracer
+const ScopeName = "golazy.dev/lazydispatch/otel"
+
+// Instrumenter is a lazydispatch.Instrumenter that creates OpenTelemetry spans
+type Instrumenter struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// Option configures an Instrumenter
+type Option func(*Instrumenter)
+
+// WithTracerProvider sets the tracer provider. It defaults to the global one.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(i *Instrumenter) {
+		i.tracer = tp.Tracer(ScopeName)
+	}
+}
+
+// WithPropagator sets the propagator used to extract the parent span from the
+// request headers. It defaults to the global one.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(i *Instrumenter) {
+		i.propagator = p
+	}
+}
+
+// New returns an Instrumenter to be used with Dispatcher.Instrument
+func New(opts ...Option) *Instrumenter {
+	i := &Instrumenter{}
+	for _, opt := range opts {
+		opt(i)
+	}
+	if i.tracer == nil {
+		i.tracer = otel.GetTracerProvider().Tracer(ScopeName)
+	}
+	if i.propagator == nil {
+		i.propagator = otel.GetTextMapPropagator()
+	}
+	return i
+}
+
+// Start opens a span for the event
+func (i *Instrumenter) Start(ctx context.Context, e lazydispatch.Event) context.Context {
+	if e.Kind != lazydispatch.EventRequest {
+		ctx, _ = i.tracer.Start(ctx, e.Name,
+			trace.WithSpanKind(trace.SpanKindInternal),
+			trace.WithAttributes(attribute.String("lazydispatch.event", e.Kind.String())),
+		)
+		return ctx
+	}
+
+	ctx = i.propagator.Extract(ctx, propagation.HeaderCarrier(e.Request.Header))
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(e.Request.Method),
+		semconv.URLPath(e.Request.URL.Path),
+		attribute.String("lazydispatch.target", e.Name),
+	}
+	if e.Route != nil {
+		attrs = append(attrs, semconv.HTTPRoute(e.Route.Path))
+		if e.Route.Name != "" {
+			attrs = append(attrs, attribute.String("lazydispatch.route", e.Route.Name))
+		}
+	}
+	ctx, _ = i.tracer.Start(ctx, spanName(e),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attrs...),
+	)
+	return ctx
+}
+
+// Finish records the error of the event, if any, and ends its span
+func (i *Instrumenter) Finish(ctx context.Context, e lazydispatch.Event) {
+	span := trace.SpanFromContext(ctx)
+	if e.Err != nil {
+		span.RecordError(e.Err)
+		span.SetStatus(codes.Error, e.Err.Error())
+	}
+	if e.Kind == lazydispatch.EventRequest && e.Status != 0 {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(e.Status))
+		if e.Status >= http.StatusInternalServerError && e.Err == nil {
+			span.SetStatus(codes.Error, http.StatusText(e.Status))
+		}
+	}
+	span.End()
+}
+
+// spanName returns the route name, or the route target if it has no name
+func spanName(e lazydispatch.Event) string {
+	if e.Route != nil && e.Route.Name != "" {
+		return e.Route.Name
+	}
+	return e.Name
+}
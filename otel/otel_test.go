@@ -0,0 +1,138 @@
+package otel
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"golazy.dev/lazydispatch"
+)
+
+type Post struct{}
+
+type PostsController struct{}
+
+func (c *PostsController) Gen_Post() *Post {
+	return &Post{}
+}
+
+func (c *PostsController) Before_Load(p *Post) {}
+
+func (c *PostsController) Index() string {
+	return "index"
+}
+
+func (c *PostsController) Show(id string) error {
+	return errors.New("not found " + id)
+}
+
+func (c *PostsController) HandleError(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func newDispatcher() (*lazydispatch.Dispatcher, *tracetest.SpanRecorder) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	d := lazydispatch.New()
+	d.Instrument(New(WithTracerProvider(tp)))
+	d.Draw(func(r *lazydispatch.Scope) {
+		r.Resources(&PostsController{}).Path("posts")
+	})
+	return d, sr
+}
+
+func TestInstrumenter(t *testing.T) {
+	d, sr := newDispatcher()
+	d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/posts", nil))
+
+	spans := sr.Ended()
+	names := []string{}
+	for _, s := range spans {
+		names = append(names, s.Name())
+	}
+	expected := []string{"Gen_Post", "Before_Load", "Index", "posts"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected spans %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("expected spans %v, got %v", expected, names)
+		}
+	}
+
+	server := spans[3]
+	if server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("expected a server span, got %s", server.SpanKind())
+	}
+	if spans[1].Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("expected Before_Load to be a child of the request span")
+	}
+	if spans[0].Parent().SpanID() != spans[1].SpanContext().SpanID() {
+		t.Errorf("expected Gen_Post to be a child of Before_Load")
+	}
+}
+
+func TestInstrumenter_Errors(t *testing.T) {
+	d, sr := newDispatcher()
+	d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/posts/3", nil))
+
+	for _, s := range sr.Ended() {
+		if s.Name() != "HandleError" {
+			continue
+		}
+		if s.Status().Code != codes.Error || s.Status().Description != "not found 3" {
+			t.Errorf("expected HandleError span to have the error status, got %+v", s.Status())
+		}
+		if len(s.Events()) != 1 || s.Events()[0].Name != "exception" {
+			t.Errorf("expected HandleError span to record the error, got %+v", s.Events())
+		}
+		return
+	}
+	t.Error("expected a HandleError span")
+}
+
+type CommentsController struct{}
+
+func (c *CommentsController) Index() string {
+	panic("broken comments")
+}
+
+func (c *CommentsController) Show(id string) error {
+	return lazydispatch.NotFound(errors.New("no comment " + id))
+}
+
+func TestInstrumenter_Unhandled(t *testing.T) {
+	for path, action := range map[string]string{
+		"/comments":   "Index",
+		"/comments/3": "Show",
+	} {
+		sr := tracetest.NewSpanRecorder()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+		d := lazydispatch.New()
+		d.Instrument(New(WithTracerProvider(tp)))
+		d.Draw(func(r *lazydispatch.Scope) {
+			r.Resources(&CommentsController{}).Path("comments")
+		})
+		d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+
+		ended := false
+		for _, s := range sr.Ended() {
+			if s.Name() != action {
+				continue
+			}
+			ended = true
+			if s.Status().Code != codes.Error {
+				t.Errorf("%s: expected the %s span to have the error status, got %+v", path, action, s.Status())
+			}
+		}
+		if !ended {
+			t.Errorf("%s: expected the %s span to end", path, action)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package lazydispatch
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Path parameters fill the parameters of actions, filters and generators of type string,
+// the integer types and the types implementing encoding.TextUnmarshaler, like most uuid types.
+// They are filled by position, the last path parameter first:
+//
+//	// GET /posts/:post_id/comments/:comment_id
+//	func (c *CommentsController) Show(commentID int, postID int64) string
+//
+// Or by name, with the fields of a struct tagged with param:
+//
+//	type CommentParams struct {
+//		PostID    int64     `param:"post_id"`
+//		CommentID uuid.UUID `param:"comment_id"`
+//	}
+//
+//	func (c *CommentsController) Show(p CommentParams) string
+//
+// Types other than string that have a provider, or for which the route has no :param left,
+// come from the provider or the request context instead.
+// Values that can't be converted make the request fail with 404 Not Found before the method runs.
+
+var tTextUnmarshaler = reflect.TypeFor[encoding.TextUnmarshaler]()
+
+// isParamType reports if a path parameter can be converted to t
+func isParamType(t reflect.Type) bool {
+	if t == tString || reflect.PointerTo(t).Implements(tTextUnmarshaler) {
+		return true
+	}
+	if t.PkgPath() != "" {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// convertParam converts the value of a path parameter to t
+func convertParam(t reflect.Type, s string) (reflect.Value, error) {
+	if t == tString {
+		return reflect.ValueOf(s), nil
+	}
+	if reflect.PointerTo(t).Implements(tTextUnmarshaler) {
+		v := reflect.New(t)
+		if err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return reflect.Value{}, err
+		}
+		return v.Elem(), nil
+	}
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetUint(n)
+	default:
+		return reflect.Value{}, fmt.Errorf("can't convert a path parameter to %s", t)
+	}
+	return v, nil
+}
+
+// paramField is a field of a struct filled with the path parameter of its param tag
+type paramField struct {
+	index int
+	name  string
+}
+
+// paramFields returns the fields of a struct tagged with param, or nil if there are none.
+// It panics if a tagged field has a type that can't be converted.
+func paramFields(t reflect.Type) []paramField {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []paramField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := f.Tag.Lookup("param")
+		if !ok {
+			continue
+		}
+		if !f.IsExported() || !isParamType(f.Type) {
+			panic(fmt.Sprintf("%s.%s: path parameter %q can't be converted to %s", t, f.Name, name, f.Type))
+		}
+		fields = append(fields, paramField{index: i, name: name})
+	}
+	return fields
+}
+
+// paramNames returns the names of the path and subdomain parameters of the route, in the order of callctx.params
+func paramNames(route *Route) []string {
+	names := []string{}
+	for _, s := range strings.Split(route.Path, "/") {
+		if isParam(s) {
+			names = append(names, s[1:])
+		}
+	}
+	subdomain := subdomainParams(route.Subdomain)
+	slices.Reverse(names)
+	slices.Reverse(subdomain)
+	return append(names, subdomain...)
+}
+
+// routeParams are the positions and names of the parameters of a route, so that
+// the requests don't have to split its path again
+type routeParams struct {
+	segments []int    // segments are the indexes of the :param segments of the path
+	names    []string // names are the names of the path and subdomain parameters, in the order of callctx.params
+}
+
+func newRouteParams(route *Route) *routeParams {
+	p := &routeParams{names: paramNames(route)}
+	for i, s := range strings.Split(route.Path, "/") {
+		if isParam(s) {
+			p.segments = append(p.segments, i)
+		}
+	}
+	return p
+}
+
+// paramsInfo returns the parameters of the route, set by Draw for the routes of actions
+func (route *Route) paramsInfo() *routeParams {
+	if route.params != nil {
+		return route.params
+	}
+	return newRouteParams(route)
+}
+
+// values returns the values of the parameters in the path of a request and its subdomains,
+// in the order of callctx.params: the last path parameter first and the subdomain ones after them
+func (p *routeParams) values(path string, subdomains Subdomains) []string {
+	values := make([]string, len(p.names))
+	n := len(p.segments)
+	segment, start, k := 0, 0, 0
+	for i := 0; i <= len(path) && k < n; i++ {
+		if i < len(path) && path[i] != '/' {
+			continue
+		}
+		if segment == p.segments[k] {
+			values[n-1-k] = path[start:i]
+			k++
+		}
+		segment, start = segment+1, i+1
+	}
+	for i, name := range p.names[n:] {
+		values[n+i] = subdomains[name]
+	}
+	return values
+}
+
+// paramStruct fills a struct with the path parameters named by the param tags of its fields
+func paramStruct(ctx *callctx, in inputPlan) (reflect.Value, error) {
+	names := ctx.route.paramsInfo().names
+	v := reflect.New(in.t).Elem()
+	for _, f := range in.fields {
+		i := slices.Index(names, f.name)
+		if i < 0 || i >= len(ctx.params) {
+			return reflect.Value{}, fmt.Errorf("method %s#%s asked for the %q path parameter that %s doesn't have", ctx.actx.t.String(), ctx.mi.name, f.name, ctx.route.Path)
+		}
+		fv := v.Field(f.index)
+		pv, err := convertParam(fv.Type(), ctx.params[i])
+		if err != nil {
+			callErrorHandler(*ctx, NotFound(fmt.Errorf("path parameter %s: %w", f.name, err)))
+			return reflect.Value{}, errStop
+		}
+		fv.Set(pv)
+	}
+	return v, nil
+}
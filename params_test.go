@@ -0,0 +1,184 @@
+package lazydispatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TicketCode is a path parameter like T-42
+type TicketCode struct {
+	N int
+}
+
+func (c *TicketCode) UnmarshalText(b []byte) error {
+	n, ok := strings.CutPrefix(string(b), "T-")
+	if !ok {
+		return errors.New("ticket codes start with T-")
+	}
+	_, err := fmt.Sscan(n, &c.N)
+	return err
+}
+
+type NoteParams struct {
+	Ticket TicketCode `param:"ticket_id"`
+	NoteID uint8      `param:"note_id"`
+}
+
+type TicketsController struct{}
+
+func (c *TicketsController) Show(id int64) string {
+	return fmt.Sprintf("ticket %d", id)
+}
+
+func (c *TicketsController) Note(p NoteParams) string {
+	return fmt.Sprintf("note %d of ticket %d", p.NoteID, p.Ticket.N)
+}
+
+func (c *TicketsController) Positional(noteID uint8, ticket TicketCode) string {
+	return fmt.Sprintf("note %d of ticket %d", noteID, ticket.N)
+}
+
+type UnknownParamController struct{}
+
+func (c *UnknownParamController) Show(p struct {
+	ID int `param:"nope"`
+}) string {
+	return ""
+}
+
+func TestDispatcher_TypedParams(t *testing.T) {
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Get("tickets/:id").To(Action(&TicketsController{}, "Show"))
+		r.Get("tickets/:ticket_id/notes/:note_id").To(Action(&TicketsController{}, "Note"))
+		r.Get("codes/:ticket_id/notes/:note_id").To(Action(&TicketsController{}, "Positional"))
+	})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/tickets/42", 200, "ticket 42"},
+		{"/tickets/abc", 404, "Not Found"},
+		{"/tickets/T-1/notes/7", 200, "note 7 of ticket 1"},
+		{"/tickets/1/notes/7", 404, "Not Found"},
+		{"/tickets/T-1/notes/300", 404, "Not Found"},
+		{"/codes/T-1/notes/7", 200, "note 7 of ticket 1"},
+		{"/codes/T-1/notes/-7", 404, "Not Found"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("GET %s: expected %d %q, got %d %q", tt.path, tt.code, tt.body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestDispatcher_TypedParamsErrors(t *testing.T) {
+	var got error
+	d := New()
+	d.OnError(func(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) bool {
+		got = err
+		return false
+	})
+	d.Draw(func(r *Scope) {
+		r.Get("tickets/:ticket_id/notes/:note_id").To(Action(&TicketsController{}, "Note"))
+	})
+	d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/tickets/X-1/notes/2", nil))
+	if StatusCode(got) != 404 || !strings.Contains(fmt.Sprint(got), "path parameter ticket_id: ticket codes start with T-") {
+		t.Errorf("expected a 404 error for ticket_id, got %v", got)
+	}
+
+	expectDrawPanic(t, New(), func(r *Scope) {
+		r.Get("things/:id").To(Action(&UnknownParamController{}, "Show"))
+	}, `asks for the "nope" parameter but /things/:id doesn't have it`)
+}
+
+func TestIsParamType(t *testing.T) {
+	for v, expected := range map[any]bool{
+		"":           true,
+		0:            true,
+		int64(0):     true,
+		uint8(0):     true,
+		TicketCode{}: true,
+		Format(""):   false,
+		1.5:          false,
+		struct{}{}:   false,
+	} {
+		if got := isParamType(reflect.TypeOf(v)); got != expected {
+			t.Errorf("%T: expected %v, got %v", v, expected, got)
+		}
+	}
+}
+
+type ScheduleController struct{}
+
+func (c *ScheduleController) Show(id int, now time.Time) string {
+	return fmt.Sprintf("ticket %d on %s", id, now.Format(time.DateOnly))
+}
+
+func (c *ScheduleController) Index(now time.Time, level slog.Level) string {
+	return fmt.Sprintf("%s %s", now.Format(time.DateOnly), level)
+}
+
+func TestDispatcher_ParamsAndProviders(t *testing.T) {
+	d := New()
+	d.Provide(func(r *http.Request) time.Time {
+		return time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	})
+	d.Provide(func(r *http.Request) slog.Level {
+		return slog.LevelWarn
+	})
+	d.Draw(func(r *Scope) {
+		r.Get("schedule/:id").To(Action(&ScheduleController{}, "Show"))
+		r.Get("schedule/:day/levels").To(Action(&ScheduleController{}, "Index"))
+	})
+
+	for path, expected := range map[string]string{
+		"/schedule/7":             "ticket 7 on 2024-05-01",
+		"/schedule/monday/levels": "2024-05-01 WARN",
+	} {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 200 || w.Body.String() != expected {
+			t.Errorf("GET %s: expected 200 %q, got %d %q", path, expected, w.Code, w.Body.String())
+		}
+	}
+}
+
+func benchmarkParams(b *testing.B, action, path string) {
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Get("tickets/:ticket_id/notes/:note_id").To(Action(&TicketsController{}, action))
+	})
+	r := httptest.NewRequest("GET", path, nil)
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, r)
+	if w.Body.String() != "note 7 of ticket 1" {
+		b.Fatalf("expected note 7 of ticket 1, got %q", w.Body.String())
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
+
+func BenchmarkPathParams(b *testing.B) {
+	benchmarkParams(b, "Positional", "/tickets/T-1/notes/7")
+}
+
+func BenchmarkParamStruct(b *testing.B) {
+	benchmarkParams(b, "Note", "/tickets/T-1/notes/7")
+}
@@ -0,0 +1,358 @@
+package lazydispatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// inputSource tells where the value of a method parameter comes from
+type inputSource int
+
+const (
+	sourceUnknown        inputSource = iota // A provider or a value in the request context
+	sourceRequest                           // *http.Request
+	sourceResponseWriter                    // http.ResponseWriter
+	sourceContext                           // context.Context
+	sourceError                             // error. Only available to HandleError
+	sourceRoute                             // *Route
+	sourcePathParam                         // path parameters, by position
+	sourceParamStruct                       // structs with fields tagged with param, filled with path parameters by name
+	sourceGenerator                         // A Gen_ method of the controller
+	sourceFormat                            // Format of the request
+	sourceSubdomains                        // Subdomains of the request
+)
+
+type inputPlan struct {
+	t         reflect.Type
+	source    inputSource
+	param     int          // param is the position of the path parameter for sourcePathParam
+	fields    []paramField // fields are the fields filled by sourceParamStruct
+	generator *methodInfo  // generator is the method to call for sourceGenerator
+}
+
+// planInputs returns how each of the parameters of the method m will be filled
+func planInputs(actx *actionctx, m reflect.Method) []inputPlan {
+	inputs := []inputPlan{}
+	params := 0
+	// The first input is the receiver
+	for i := 1; i < m.Type.NumIn(); i++ {
+		t := m.Type.In(i)
+		in := inputPlan{t: t, source: sourceOf(actx, t)}
+		switch in.source {
+		case sourcePathParam:
+			in.param = params
+			params++
+			actx.needsRoute = true
+		case sourceParamStruct:
+			in.fields = paramFields(t)
+			actx.needsRoute = true
+		case sourceRoute:
+			actx.needsRoute = true
+		case sourceGenerator:
+			in.generator = actx.generators[t.String()]
+		}
+		inputs = append(inputs, in)
+	}
+	return inputs
+}
+
+func sourceOf(actx *actionctx, t reflect.Type) inputSource {
+	switch t {
+	case tHTTPRequest:
+		return sourceRequest
+	case tHTTPResponseWriter:
+		return sourceResponseWriter
+	case tContextContext:
+		return sourceContext
+	case tError:
+		return sourceError
+	case tString:
+		return sourcePathParam
+	case tRoute:
+		return sourceRoute
+	case tFormat:
+		return sourceFormat
+	case tSubdomains:
+		return sourceSubdomains
+	}
+	if _, ok := actx.generators[t.String()]; ok {
+		return sourceGenerator
+	}
+	if isParamType(t) {
+		return sourcePathParam
+	}
+	if paramFields(t) != nil {
+		return sourceParamStruct
+	}
+	return sourceUnknown
+}
+
+// bindParams decides which parameters are filled with the path parameters of the route.
+// Strings always are. The other types that can be converted only are when they have no
+// provider and the route has a :param left for them, otherwise they come from a provider
+// or the request context as before.
+func (actx *actionctx) bindParams(route *Route, providers map[reflect.Type]provider) {
+	route.params = newRouteParams(route)
+	nParams := len(route.params.names)
+	bind := func(mi *methodInfo) {
+		n := 0
+		for i := range mi.inputs {
+			in := &mi.inputs[i]
+			if in.source != sourcePathParam && (in.source != sourceUnknown || !isParamType(in.t)) {
+				continue
+			}
+			if _, provided := providers[in.t]; in.t != tString && (provided || n >= nParams) {
+				in.source = sourceUnknown
+				continue
+			}
+			in.source = sourcePathParam
+			in.param = n
+			n++
+		}
+	}
+	for i := range actx.befores {
+		bind(&actx.befores[i])
+	}
+	for i := range actx.afters {
+		bind(&actx.afters[i])
+	}
+	for _, g := range actx.generators {
+		bind(g)
+	}
+	if actx.ErrorHandler != nil {
+		bind(actx.ErrorHandler)
+	}
+	bind(&actx.action)
+	for i := range actx.variants {
+		bind(&actx.variants[i].mi)
+	}
+}
+
+// checkActions panics with the list of the parameters that can't be resolved
+// in the actions of the routes
+func (d *Dispatcher) checkActions(routes []*Route) {
+	errs := []error{}
+	for _, route := range routes {
+		actx, ok := route.Handler.(*actionctx)
+		if !ok {
+			continue
+		}
+		if err := d.setupAction(actx, route); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", route.Method, route.Path, err))
+		}
+	}
+	if len(errs) > 0 {
+		panic(fmt.Errorf("unresolvable parameters:\n%w", errors.Join(errs...)))
+	}
+}
+
+// checkFallbacks sets up the actions used as NotFound, MethodNotAllowed, NotAcceptable and
+// InternalServerError handlers like the ones of the routes, and panics if they can't be called
+func (d *Dispatcher) checkFallbacks() {
+	errs := []error{}
+	for _, fallback := range []struct {
+		name string
+		h    http.Handler
+	}{
+		{"NotFound", d.notFound},
+		{"MethodNotAllowed", d.methodNotAllowed},
+		{"NotAcceptable", d.notAcceptable},
+		{"InternalServerError", d.internalServerError},
+	} {
+		actx, ok := fallback.h.(*actionctx)
+		if !ok {
+			continue
+		}
+		if err := d.setupAction(actx, &Route{Handler: actx}); err != nil {
+			errs = append(errs, fmt.Errorf("%s handler: %w", fallback.name, err))
+		}
+		// The errors of an error page get the default one instead of the page again
+		actx.errorPage = nil
+	}
+	if len(errs) > 0 {
+		panic(fmt.Errorf("unresolvable parameters:\n%w", errors.Join(errs...)))
+	}
+}
+
+// setupAction gives the action the settings of the dispatcher and binds its parameters to the route
+func (d *Dispatcher) setupAction(actx *actionctx, route *Route) error {
+	actx.providers = d.providers
+	actx.logger = d.logger
+	actx.instrumenters = d.instrumenters
+	actx.errorHandlers = d.errorHandlers
+	actx.renderers = d.renderers
+	actx.notAcceptable = d.notAcceptable
+	actx.errorPage = d.errorPage
+	if actx.onlyVariants && len(route.Formats) == 0 {
+		route.Formats = actx.variantFormats()
+	}
+	actx.bindParams(route, d.providers)
+	return actx.validate(route, d.providers)
+}
+
+// methods returns all the methods that can be called when serving the action
+func (actx *actionctx) methods() []methodInfo {
+	methods := []methodInfo{}
+	methods = append(methods, actx.befores...)
+	methods = append(methods, actx.action)
+	for _, v := range actx.variants {
+		if v.mi.name != actx.action.name {
+			methods = append(methods, v.mi)
+		}
+	}
+	methods = append(methods, actx.afters...)
+	for _, g := range actx.generators {
+		methods = append(methods, *g)
+	}
+	if actx.ErrorHandler != nil {
+		methods = append(methods, *actx.ErrorHandler)
+	}
+	return methods
+}
+
+// validate returns an error for every parameter that can't be resolved when
+// the action is served by route with the given providers.
+func (actx *actionctx) validate(route *Route, providers map[reflect.Type]provider) error {
+	errs := []error{}
+	nParams := len(subdomainParams(route.Subdomain))
+	for _, s := range strings.Split(route.Path, "/") {
+		if strings.HasPrefix(s, ":") {
+			nParams++
+		}
+	}
+
+	for _, mi := range actx.methods() {
+		nPathParams := 0
+		for _, in := range mi.inputs {
+			switch in.source {
+			case sourceError:
+				if actx.ErrorHandler == nil || mi.name != actx.ErrorHandler.name {
+					errs = append(errs, fmt.Errorf("%s#%s: error parameters are only available in HandleError", actx.t.String(), mi.name))
+				}
+			case sourcePathParam:
+				nPathParams++
+			case sourceParamStruct:
+				for _, f := range in.fields {
+					if !slices.Contains(route.params.names, f.name) {
+						errs = append(errs, fmt.Errorf("%s#%s: asks for the %q parameter but %s doesn't have it", actx.t.String(), mi.name, f.name, route.Path))
+					}
+				}
+			case sourceUnknown:
+				if _, ok := providers[in.t]; !ok {
+					errs = append(errs, fmt.Errorf("%s#%s: parameter %s has no generator or provider. Use FromContext for the values of the request context", actx.t.String(), mi.name, in.t.String()))
+				}
+			}
+		}
+		if nPathParams > nParams {
+			errs = append(errs, fmt.Errorf("%s#%s: asks for %d path parameters but %s only has %d", actx.t.String(), mi.name, nPathParams, route.Path, nParams))
+		}
+	}
+
+	errs = append(errs, actx.generatorCycles()...)
+	return errors.Join(errs...)
+}
+
+// generatorCycles returns an error for every generator that depends on itself
+func (actx *actionctx) generatorCycles() []error {
+	errs := []error{}
+	for name, g := range actx.generators {
+		visited := map[string]bool{}
+		var visit func(g *methodInfo) bool
+		visit = func(g *methodInfo) bool {
+			for _, in := range g.inputs {
+				if in.source != sourceGenerator {
+					continue
+				}
+				dep := in.t.String()
+				if dep == name {
+					return true
+				}
+				if visited[dep] {
+					continue
+				}
+				visited[dep] = true
+				if visit(actx.generators[dep]) {
+					return true
+				}
+			}
+			return false
+		}
+		if visit(g) {
+			errs = append(errs, fmt.Errorf("%s#%s: generator of %s depends on itself", actx.t.String(), g.name, name))
+		}
+	}
+	return errs
+}
+
+// provider is a function registered with Dispatcher.Provide
+type provider struct {
+	fn     reflect.Value
+	hasErr bool
+}
+
+// Provide registers a function that provides values of a type to all the actions,
+// filters and generators that ask for it.
+// fn must have one of the following signatures:
+//
+//	func(r *http.Request) T
+//	func(r *http.Request) (T, error)
+//
+// It is called every time a parameter of type T has to be filled.
+// If it returns an error, the error is handled as if it was returned by a generator.
+// Providers should be registered before calling Draw, as Draw checks that every
+// parameter of the drawn actions can be resolved.
+//
+//	d.Provide(func(r *http.Request) (*User, error) {
+//		return currentUser(r)
+//	})
+func (d *Dispatcher) Provide(fn any) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func ||
+		t.NumIn() != 1 || t.In(0) != tHTTPRequest ||
+		t.NumOut() == 0 || t.NumOut() > 2 ||
+		(t.NumOut() == 2 && t.Out(1) != tError) {
+		panic(fmt.Sprintf("provider must be a func(*http.Request) T or func(*http.Request) (T, error). Got %s", t.String()))
+	}
+	d.providers[t.Out(0)] = provider{fn: v, hasErr: t.NumOut() == 2}
+}
+
+// FromContext declares that the values of type T come from the request context, where a
+// middleware stores them with WithValue. Without it, Draw fails for the actions that ask for T.
+// If the request has no value of type T, it is handled as an error returned by a generator.
+//
+//	lazydispatch.FromContext[*User](d)
+//	d.Use(func(next http.Handler) http.Handler {
+//		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//			next.ServeHTTP(w, r.WithContext(lazydispatch.WithValue(r.Context(), currentUser(r))))
+//		})
+//	})
+func FromContext[T any](d *Dispatcher) {
+	t := reflect.TypeFor[T]()
+	d.Provide(func(r *http.Request) (T, error) {
+		v, ok := r.Context().Value(t).(T)
+		if !ok {
+			return v, fmt.Errorf("%s not found in the request context", t)
+		}
+		return v, nil
+	})
+}
+
+// WithValue returns a copy of ctx with v, that the parameters of type T of actions,
+// filters and generators receive when the type is declared with FromContext
+func WithValue[T any](ctx context.Context, v T) context.Context {
+	return context.WithValue(ctx, reflect.TypeFor[T](), v)
+}
+
+func (p provider) call(r *http.Request) (reflect.Value, error) {
+	outs := p.fn.Call([]reflect.Value{reflect.ValueOf(r)})
+	if p.hasErr && !outs[1].IsNil() {
+		return reflect.Value{}, outs[1].Interface().(error)
+	}
+	return outs[0], nil
+}
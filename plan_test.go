@@ -0,0 +1,104 @@
+package lazydispatch
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+type Account struct {
+	Name string
+}
+
+type UnresolvableController struct{}
+
+func (*UnresolvableController) Index(a *Account) string {
+	return a.Name
+}
+
+func (*UnresolvableController) Show(a, b string) string {
+	return a + b
+}
+
+func (*UnresolvableController) Before_Error(err error) {}
+
+type CycleController struct{}
+
+func (*CycleController) Gen_Account(a *Account) *Account {
+	return a
+}
+
+func (*CycleController) Index(a *Account) string {
+	return a.Name
+}
+
+func TestDraw_UnresolvableParameters(t *testing.T) {
+	expectDrawPanic(t, New(), func(r *Scope) {
+		r.Resources(&UnresolvableController{})
+	},
+		"unresolvable parameters:",
+		"*lazydispatch.UnresolvableController#Index: parameter *lazydispatch.Account has no generator or provider",
+		"*lazydispatch.UnresolvableController#Show: asks for 2 path parameters but /unresolvables/:unresolvable_id only has 1",
+		"*lazydispatch.UnresolvableController#Before_Error: error parameters are only available in HandleError",
+	)
+
+	expectDrawPanic(t, New(), func(r *Scope) {
+		r.Resources(&CycleController{})
+	}, "*lazydispatch.CycleController#Gen_Account: generator of *lazydispatch.Account depends on itself")
+}
+
+type AccountsController struct{}
+
+func (*AccountsController) Index(a *Account) string {
+	return "hello " + a.Name
+}
+
+func (*AccountsController) HandleError(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(err.Error()))
+}
+
+func TestDispatcher_Provide(t *testing.T) {
+	d := New()
+	d.Provide(func(r *http.Request) (*Account, error) {
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			return nil, errors.New("no account")
+		}
+		return &Account{Name: name}, nil
+	})
+	d.Draw(func(r *Scope) {
+		r.Resources(&AccountsController{})
+	})
+
+	expect2(t, d, "GET", "/accounts?name=golazy", nil, http.StatusOK, "hello golazy")
+	expect2(t, d, "GET", "/accounts", nil, http.StatusUnauthorized, "no account")
+}
+
+func TestDispatcher_ProvideSignature(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected Provide to panic with an invalid provider")
+		}
+	}()
+	New().Provide(func() *Account { return nil })
+}
+
+func TestDispatcher_FromContext(t *testing.T) {
+	d := New()
+	FromContext[*Account](d)
+	d.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if name := r.URL.Query().Get("name"); name != "" {
+				r = r.WithContext(WithValue(r.Context(), &Account{Name: name}))
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	d.Draw(func(r *Scope) {
+		r.Resources(&AccountsController{})
+	})
+
+	expect2(t, d, "GET", "/accounts?name=golazy", nil, http.StatusOK, "hello golazy")
+	expect2(t, d, "GET", "/accounts", nil, http.StatusUnauthorized, "*lazydispatch.Account not found in the request context")
+}
@@ -0,0 +1,106 @@
+package lazydispatch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+type errorKey struct{}
+
+// unhandledError is a panic of an action that neither the controller nor the OnError handlers
+// handled. The controller lets it go up to the Dispatcher untouched, through the middlewares
+// that show panics like NicePanics.
+type unhandledError struct {
+	err error
+}
+
+func (u unhandledError) Error() string {
+	return u.err.Error()
+}
+
+func (u unhandledError) Unwrap() error {
+	return u.err
+}
+
+// ErrorFrom returns the error that is being handled by the InternalServerError, NotFound or MethodNotAllowed handler.
+// Use StatusCode to get its status.
+func ErrorFrom(ctx context.Context) error {
+	err, _ := ctx.Value(errorKey{}).(error)
+	return err
+}
+
+// errorPage returns the handler for an error with the status: the NotFound, MethodNotAllowed and
+// NotAcceptable handlers for 404, 405 and 406, and the InternalServerError one for the rest
+func (d *Dispatcher) errorPage(status int) http.Handler {
+	switch status {
+	case http.StatusNotFound:
+		return d.notFound
+	case http.StatusMethodNotAllowed:
+		return d.methodNotAllowed
+	case http.StatusNotAcceptable:
+		return d.notAcceptable
+	}
+	return d.internalServerError
+}
+
+// logError logs an error that no handler took, with the stack of the panic if any.
+// The 5xx errors are logged as errors and the rest as info.
+func logError(logger *slog.Logger, r *http.Request, msg string, err error, status int, sent bool, stack []byte) {
+	attrs := []any{
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+	}
+	if route := RouteFrom(r.Context()); route != nil {
+		attrs = append(attrs, slog.String("route", route.Name), slog.String("target", route.Target))
+	}
+	attrs = append(attrs, slog.Any("error", err), slog.Int("status", status), slog.Bool("sent", sent))
+	if stack != nil {
+		attrs = append(attrs, slog.String("stack", string(stack)))
+	}
+	level := slog.LevelError
+	if status < http.StatusInternalServerError {
+		level = slog.LevelInfo
+	}
+	logger.Log(r.Context(), level, msg, attrs...)
+}
+
+// recoverer converts the panics of the matched handlers into a response served by the
+// error page for the StatusCode of the error.
+// When the response was already started it can't send another status, so the error is only logged.
+func (d *Dispatcher) recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			// The handler wants to abort the response
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			err, ok := p.(error)
+			if u, unhandled := p.(unhandledError); unhandled {
+				err = u.err
+			} else if !ok {
+				err = fmt.Errorf("panic: %v", p)
+			}
+			status := StatusCode(err)
+			logError(d.logger, r, "panic", err, status, sw.status != 0, debug.Stack())
+
+			if sw.status != 0 {
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), errorKey{}, err))
+			// The errors of the controllers already went through the handlers
+			if _, unhandled := p.(unhandledError); !unhandled && handleError(d.errorHandlers, w, r, err) {
+				return
+			}
+			serveWithStatus(d.errorPage(status), status, w, r)
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
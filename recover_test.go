@@ -0,0 +1,80 @@
+package lazydispatch
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var errBroken = errors.New("broken")
+
+type BrokenController struct{}
+
+func (c *BrokenController) Gen_User(r *http.Request) (*User, error) {
+	if r.URL.Query().Has("gen") {
+		return nil, errBroken
+	}
+	return &User{}, nil
+}
+
+func (c *BrokenController) Index(w http.ResponseWriter, u *User) {
+	panic("index is broken")
+}
+
+func (c *BrokenController) Show(w http.ResponseWriter, r *http.Request, u *User) {
+	w.Write([]byte("partial"))
+	panic("show is broken")
+}
+
+func TestDispatcher_Recover(t *testing.T) {
+	buf := &bytes.Buffer{}
+	d := New()
+	d.Logger(slog.New(slog.NewTextHandler(buf, nil)))
+	d.Draw(func(r *Scope) {
+		r.Resources(&BrokenController{}).Path("broken")
+		r.Get("abort").To(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}))
+	})
+
+	expect2(t, d, "GET", "/broken", nil, http.StatusInternalServerError, "Internal Server Error")
+	if out := buf.String(); !strings.Contains(out, "level=ERROR msg=panic") ||
+		!strings.Contains(out, "target=BrokenController#Index") || !strings.Contains(out, "index is broken") {
+		t.Errorf("expected the panic to be logged with the target, got %q", out)
+	}
+
+	// Errors of generators without HandleError
+	expect2(t, d, "GET", "/broken?gen", nil, http.StatusInternalServerError, "Internal Server Error")
+
+	// The response was started
+	buf.Reset()
+	expect2(t, d, "GET", "/broken/1", nil, http.StatusOK, "partial")
+	if !strings.Contains(buf.String(), "sent=true") {
+		t.Errorf("expected the panic to be logged, got %q", buf.String())
+	}
+
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("expected ErrAbortHandler to go through, got %v", p)
+		}
+	}()
+	d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/abort", nil))
+}
+
+func TestDispatcher_InternalServerError(t *testing.T) {
+	d := New()
+	d.InternalServerError(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if errors.Is(ErrorFrom(r.Context()), errBroken) {
+			w.Write([]byte("sorry: " + RouteFrom(r.Context()).Target))
+		}
+	}))
+	d.Draw(func(r *Scope) {
+		r.Resources(&BrokenController{}).Path("broken")
+	})
+
+	expect2(t, d, "GET", "/broken?gen", nil, http.StatusInternalServerError, "sorry: BrokenController#Index")
+}
@@ -0,0 +1,102 @@
+package lazydispatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+)
+
+// Renderer encodes the structs, maps and slices returned by the actions
+type Renderer interface {
+	Render(w io.Writer, v any) error
+}
+
+// RendererFunc is a function that implements Renderer
+type RendererFunc func(w io.Writer, v any) error
+
+func (f RendererFunc) Render(w io.Writer, v any) error {
+	return f(w, v)
+}
+
+type renderer struct {
+	mime   string
+	format Format
+	r      Renderer
+}
+
+// JSONRenderer encodes the values with encoding/json. It is the default renderer.
+var JSONRenderer = RendererFunc(func(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+})
+
+var defaultRenderers = []renderer{{mime: "application/json", format: "json", r: JSONRenderer}}
+
+// AddRenderer registers a Renderer for a MIME type, replacing the previous one if any.
+// The first registered type, application/json unless replaced, is used when the client accepts any type.
+//
+//	d.AddRenderer("application/xml", lazydispatch.RendererFunc(func(w io.Writer, v any) error {
+//		return xml.NewEncoder(w).Encode(v)
+//	}))
+//
+// They have to be added before calling Draw.
+func (d *Dispatcher) AddRenderer(mime string, r Renderer) {
+	if i := slices.IndexFunc(d.renderers, func(rr renderer) bool { return rr.mime == mime }); i != -1 {
+		d.renderers[i].r = r
+		return
+	}
+	d.renderers = append(d.renderers, renderer{mime: mime, format: formatOf(mime), r: r})
+}
+
+// errNoRenderer is returned by render when there is no renderer for the format of the request
+var errNoRenderer = errors.New("no renderer for the format")
+
+// rendererFor returns the renderer for the format of the request.
+// It falls back to the first renderer only when the request has no format.
+func rendererFor(renderers []renderer, r *http.Request) (renderer, bool) {
+	if len(renderers) == 0 {
+		renderers = defaultRenderers
+	}
+	format := FormatFrom(r.Context())
+	if format == "" {
+		return renderers[0], true
+	}
+	for _, rr := range renderers {
+		if rr.format == format {
+			return rr, true
+		}
+	}
+	return renderer{}, false
+}
+
+// isRenderable reports if the value returned by an action has to go through a Renderer
+func isRenderable(v reflect.Value) bool {
+	t := v.Type()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
+
+// render encodes v with the renderer for the request
+func render(renderers []renderer, r *http.Request, header http.Header, v any) ([]byte, error) {
+	rr, ok := rendererFor(renderers, r)
+	if !ok {
+		return nil, errNoRenderer
+	}
+	buf := &bytes.Buffer{}
+	if err := rr.r.Render(buf, v); err != nil {
+		return nil, err
+	}
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", rr.mime)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,117 @@
+package lazydispatch
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type Book struct {
+	XMLName xml.Name `json:"-" xml:"book"`
+	ID      int      `json:"id" xml:"id,attr"`
+	Title   string   `json:"title" xml:"title"`
+}
+
+type BooksController struct{}
+
+func (c *BooksController) Index() []Book {
+	return []Book{{ID: 1, Title: "Dune"}, {ID: 2, Title: "Emma"}}
+}
+
+func (c *BooksController) Show(id string) (*Book, error) {
+	if id != "1" {
+		return nil, NotFound(nil)
+	}
+	return &Book{ID: 1, Title: "Dune"}, nil
+}
+
+func (c *BooksController) Create() (int, map[string]any) {
+	return http.StatusCreated, map[string]any{"id": 3}
+}
+
+func TestDispatcher_Render(t *testing.T) {
+	d := New()
+	d.AddRenderer("application/xml", RendererFunc(func(w io.Writer, v any) error {
+		return xml.NewEncoder(w).Encode(v)
+	}))
+	d.AddRenderer("text/csv", RendererFunc(func(w io.Writer, v any) error {
+		books, ok := v.([]Book)
+		if !ok {
+			return errors.New("not books")
+		}
+		for _, b := range books {
+			io.WriteString(w, b.Title+"\n")
+		}
+		return nil
+	}))
+	d.Draw(func(r *Scope) {
+		r.Resources(&BooksController{}).Path("books")
+	})
+
+	tests := []struct {
+		name, method, path, accept string
+		code                       int
+		ct, body                   string
+	}{
+		{"slice", "GET", "/books", "", 200, "application/json", `[{"id":1,"title":"Dune"},{"id":2,"title":"Emma"}]` + "\n"},
+		{"any", "GET", "/books/1", "*/*", 200, "application/json", `{"id":1,"title":"Dune"}` + "\n"},
+		{"xml", "GET", "/books/1", "application/xml", 200, "application/xml", `<book id="1"><title>Dune</title></book>`},
+		{"unknown type", "GET", "/books/1", "image/png", 200, "application/json", `{"id":1,"title":"Dune"}` + "\n"},
+		{"error", "GET", "/books/2", "", 404, "", "Not Found"},
+		{"status and map", "POST", "/books", "", 201, "application/json", `{"id":3}` + "\n"},
+		{"csv", "GET", "/books", "text/csv", 200, "text/csv", "Dune\nEmma\n"},
+		{"no renderer", "GET", "/books/1", "text/html", 406, "", "Not Acceptable"},
+		{"no renderer extension", "GET", "/books/1.html", "", 406, "", "Not Acceptable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			d.ServeHTTP(w, r)
+			if w.Code != tt.code {
+				t.Errorf("expected code %d, got %d", tt.code, w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); tt.ct != "" && ct != tt.ct {
+				t.Errorf("expected content type %q, got %q", tt.ct, ct)
+			}
+			if w.Body.String() != tt.body {
+				t.Errorf("expected body %q, got %q", tt.body, w.Body.String())
+			}
+		})
+	}
+
+	expect := func(h http.Handler, accept string, code int) {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/books/1", nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != code {
+			t.Errorf("expected code %d, got %d", code, w.Code)
+		}
+	}
+	d2 := New()
+	d2.AddRenderer("application/json", RendererFunc(func(w io.Writer, v any) error {
+		return errors.New("can't encode")
+	}))
+	d2.Draw(func(r *Scope) {
+		r.Resources(&BooksController{}).Path("books")
+	})
+	expect(d2, "application/json", http.StatusInternalServerError)
+}
+
+func TestProcessActionOutput_Unknown(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for channels")
+		}
+	}()
+	processActionOutput(&callctx{}, []reflect.Value{reflect.ValueOf(make(chan int))}, httptest.NewRecorder())
+}
@@ -0,0 +1,103 @@
+package lazydispatch
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// variant is a method that answers an action in one format, like Show_JSON for Show.
+// Variants share the filters, generators and error handler of the action.
+//
+//	func (c *PostsController) Show_HTML(id string) string { ... }
+//	func (c *PostsController) Show_JSON(id string) *Post { ... }
+type variant struct {
+	format Format
+	mi     methodInfo
+}
+
+// splitVariant splits a method name like Show_JSON into the action and its format.
+// The suffix must be one of formats in uppercase, or of the known formats if formats is nil.
+// Custom actions made of just an HTTP method, like Get_CSV for GET /posts/csv, aren't variants.
+func splitVariant(name string, formats []formatMIME) (string, Format, bool) {
+	i := strings.LastIndex(name, "_")
+	if i <= 0 {
+		return name, "", false
+	}
+	suffix := name[i+1:]
+	if suffix == "" || suffix != strings.ToUpper(suffix) {
+		return name, "", false
+	}
+	if formats == nil {
+		formats = knownFormats
+	}
+	format := Format(strings.ToLower(suffix))
+	if !slices.ContainsFunc(formats, func(k formatMIME) bool { return k.format == format }) {
+		return name, "", false
+	}
+	base := name[:i]
+	if strings.HasPrefix(base, "Member") {
+		base = strings.TrimPrefix(base[len("Member"):], "_")
+	}
+	if _, rest, ok := getMethodFromMethodName(base); ok && rest == "" {
+		return name, "", false
+	}
+	return name[:i], format, true
+}
+
+// actionNames returns the actions of the methods, once per action even if it has many variants
+func actionNames(names []string, formats []formatMIME) []string {
+	actions := []string{}
+	for _, name := range names {
+		if action, _, ok := splitVariant(name, formats); ok {
+			name = action
+		}
+		if !slices.Contains(actions, name) {
+			actions = append(actions, name)
+		}
+	}
+	return actions
+}
+
+// methodNames returns the names of the methods of the controller
+func methodNames(controller any) []string {
+	t := reflect.TypeOf(controller)
+	names := make([]string, t.NumMethod())
+	for i := range names {
+		names[i] = t.Method(i).Name
+	}
+	return names
+}
+
+// variantFormats returns the formats of the variants, in order of preference
+func (actx *actionctx) variantFormats() []Format {
+	formats := []Format{}
+	for _, v := range actx.variants {
+		formats = append(formats, v.format)
+	}
+	return formats
+}
+
+// methodFor returns the method that answers the format: its variant, or the action itself.
+// It returns false when the action only has variants and none is for the format.
+func (actx *actionctx) methodFor(f Format) (methodInfo, bool) {
+	for _, v := range actx.variants {
+		if v.format == f {
+			return v.mi, true
+		}
+	}
+	if f == "" || !actx.onlyVariants {
+		return actx.action, true
+	}
+	return methodInfo{}, false
+}
+
+// formatRank returns the position of the format in the known formats, with unknown ones last
+func formatRank(f Format) int {
+	for i, k := range knownFormats {
+		if k.format == f {
+			return i
+		}
+	}
+	return len(knownFormats)
+}
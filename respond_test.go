@@ -0,0 +1,185 @@
+package lazydispatch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+type Invoice struct {
+	ID    string `json:"id"`
+	Total int    `json:"total"`
+}
+
+type InvoiceTotal int
+
+type InvoicesController struct {
+	filtered bool
+}
+
+func (c *InvoicesController) Before_Filter() {
+	c.filtered = true
+}
+
+func (c *InvoicesController) Gen_Total() InvoiceTotal {
+	return 10
+}
+
+func (c *InvoicesController) Index_HTML() string {
+	return "<p>invoices</p>"
+}
+
+func (c *InvoicesController) Index_JSON(total InvoiceTotal) []Invoice {
+	return []Invoice{{ID: "1", Total: int(total)}}
+}
+
+func (c *InvoicesController) Show(id string) string {
+	return "invoice " + id
+}
+
+func (c *InvoicesController) Show_CSV(id string, total InvoiceTotal) string {
+	if !c.filtered {
+		return "not filtered"
+	}
+	return fmt.Sprintf("id,total\n%s,%d\n", id, total)
+}
+
+func TestDispatcher_Variants(t *testing.T) {
+	d := New()
+	d.Draw(func(r *Scope) {
+		r.Resources(&InvoicesController{}).Path("invoices")
+	})
+
+	tests := []struct {
+		method, path, accept string
+		code                 int
+		body                 string
+	}{
+		{"GET", "/invoices", "", 200, "<p>invoices</p>"},
+		{"GET", "/invoices", "*/*", 200, "<p>invoices</p>"},
+		{"GET", "/invoices.json", "", 200, `[{"id":"1","total":10}]` + "\n"},
+		{"GET", "/invoices", "application/json", 200, `[{"id":"1","total":10}]` + "\n"},
+		{"GET", "/invoices", "application/xml, application/json;q=0.5", 200, `[{"id":"1","total":10}]` + "\n"},
+		{"GET", "/invoices", "application/xml", 406, "Not Acceptable"},
+		{"GET", "/invoices.csv", "", 404, "Not Found"},
+		{"GET", "/invoices/2", "", 200, "invoice 2"},
+		{"GET", "/invoices/2.csv", "", 200, "id,total\n2,10\n"},
+		{"GET", "/invoices/2", "text/csv", 200, "id,total\n2,10\n"},
+		{"GET", "/invoices/2.json", "", 200, "invoice 2"},
+		{"GET", "/invoices/index_json", "", 200, "invoice index_json"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, r)
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("%s %s (Accept: %s): expected %d %q, got %d %q", tt.method, tt.path, tt.accept, tt.code, tt.body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestForAction_Variants(t *testing.T) {
+	h := Action(&InvoicesController{}, "Index")
+
+	for format, expected := range map[Format]string{
+		"":     "<p>invoices</p>",
+		"html": "<p>invoices</p>",
+		"xml":  "Not Acceptable",
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r = r.WithContext(context.WithValue(r.Context(), formatKey{}, format))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Body.String() != expected {
+			t.Errorf("format %q: expected %q, got %q", format, expected, w.Body.String())
+		}
+	}
+}
+
+func TestSplitVariant(t *testing.T) {
+	pdf := append(slices.Clone(knownFormats), formatMIME{"pdf", "application/pdf"})
+	tests := []struct {
+		name    string
+		formats []formatMIME
+		action  string
+		format  Format
+		ok      bool
+	}{
+		{"Show_JSON", nil, "Show", "json", true},
+		{"GETStats_CSV", nil, "GETStats", "csv", true},
+		{"Show_Json", nil, "Show_Json", "", false},
+		{"Show_NOPE", nil, "Show_NOPE", "", false},
+		{"Show", nil, "Show", "", false},
+		{"_JSON", nil, "_JSON", "", false},
+		{"Show_PDF", nil, "Show_PDF", "", false},
+		{"Show_PDF", pdf, "Show", "pdf", true},
+		{"Get_CSV", nil, "Get_CSV", "", false},
+		{"Member_Get_PDF", pdf, "Member_Get_PDF", "", false},
+		{"MemberGet_TXT", nil, "MemberGet_TXT", "", false},
+		{"Member_GetStats_TXT", nil, "Member_GetStats", "txt", true},
+	}
+	for _, tt := range tests {
+		action, format, ok := splitVariant(tt.name, tt.formats)
+		if action != tt.action || format != tt.format || ok != tt.ok {
+			t.Errorf("%s: expected %q %q %v, got %q %q %v", tt.name, tt.action, tt.format, tt.ok, action, format, ok)
+		}
+	}
+}
+
+type ExportsController struct{}
+
+func (c *ExportsController) Index() string {
+	return "exports"
+}
+
+func (c *ExportsController) Index_PDF() string {
+	return "exports pdf"
+}
+
+func (c *ExportsController) Get_CSV() string {
+	return "csv export"
+}
+
+func (c *ExportsController) Member_Get_TXT(id string) string {
+	return "txt export " + id
+}
+
+func (c *ExportsController) Get_GIF() string {
+	return "gif export"
+}
+
+func TestDispatcher_CustomActionsNotVariants(t *testing.T) {
+	d := New()
+	d.AddRenderer("application/pdf", RendererFunc(func(w io.Writer, v any) error {
+		_, err := fmt.Fprint(w, v)
+		return err
+	}))
+	d.Draw(func(r *Scope) {
+		r.Resources(&ExportsController{}).Path("exports")
+	})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/exports", 200, "exports"},
+		{"/exports.pdf", 200, "exports pdf"},
+		{"/exports/csv", 200, "csv export"},
+		{"/exports/1/txt", 200, "txt export 1"},
+		{"/exports/gif", 200, "gif export"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("GET %s: expected %d %q, got %d %q", tt.path, tt.code, tt.body, w.Code, w.Body.String())
+		}
+	}
+}
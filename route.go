@@ -1,12 +1,12 @@
 package lazydispatch
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
 	"path"
 	"reflect"
-	"strings"
 )
 
 type Route struct {
@@ -22,15 +22,23 @@ type Route struct {
 	// - /posts/1.json // Rotues to /posts/1 and sets the content-type to application/json
 	// - /posts/1/      // Trailing slash are ignored
 	//
-	// The url can include ports, domains and schemas:
+	// The url can include ports, domains and schemas, that are moved to Scheme, Host and Port:
 	// - http://example.com:8080/posts/1
 	// - https://example.com/posts/1
-	// - /example.com/posts/1
+	// - //example.com/posts/1
 	// - //:3000/posts/1
 	// - http://:3000/posts/1
 	URL  string
 	Path string // Path is the path component of the URL.
 
+	// Scheme, Host and Port restrict the requests the route matches. Any is allowed when they are empty.
+	Scheme string
+	Host   string
+	Port   string
+
+	// Subdomain restricts the route to the subdomains of Host matching it, like :account or admin.:region
+	Subdomain string
+
 	Method string // One of GET, POST, PUT, PATCH, DELETE, OPTIONS, HEAD
 
 	// Models allows the router to generate paths just by providing the model
@@ -63,6 +71,23 @@ type Route struct {
 	Target string
 
 	Handler http.Handler
+
+	// Middlewares are the middlewares added with Use to the scopes of the route, outermost first.
+	// They wrap the Handler when the route is served by the Dispatcher.
+	Middlewares []func(http.Handler) http.Handler
+
+	// Formats are the formats the route answers to. Any format is allowed when it is empty.
+	Formats []Format
+
+	// SkipMiddlewares are the names of the middlewares registered with UseNamed that don't run for this route
+	SkipMiddlewares []string
+
+	// OnlyMiddlewares, when not nil, are the names of the only middlewares registered with UseNamed that run for this route
+	OnlyMiddlewares []string
+
+	handler      http.Handler // handler is the Handler wrapped by all the middlewares of the route
+	implicitHead bool         // implicitHead is set on the HEAD routes added for GET routes
+	params       *routeParams // params are the positions and names of the parameters, set by Draw
 }
 
 func (r *Route) String() string {
@@ -70,11 +95,22 @@ func (r *Route) String() string {
 
 }
 
+// chain wraps the Handler with the Middlewares of its scopes
+func (r *Route) chain() http.Handler {
+	h := r.Handler
+	for i := len(r.Middlewares) - 1; i >= 0; i-- {
+		h = r.Middlewares[i](h)
+	}
+	return h
+}
+
 func (r *Route) normalize() *Route {
+	r.assignOrigin()
 	r.assignModels()
 	r.assignDefaultMethod()
 	r.prefixURL()
 	r.assignPath()
+	r.URL = r.origin() + r.URL
 	return r
 }
 func (route *Route) assignPath() {
@@ -96,28 +132,33 @@ func (route *Route) prefixURL() {
 	}
 }
 func (route *Route) assignModels() {
-	segments := strings.Split(route.URL, "/")
-	nParams := 0
-	for _, s := range segments {
-		if strings.HasPrefix(s, ":") || s == "*" {
-			nParams++
-		}
-	}
-	if len(route.Models) == nParams {
-		return
-	}
+	nParams := countRequiredParams(route.URL)
 	if len(route.Models) == 0 {
 		for i := 0; i < nParams; i++ {
 			route.Models = append(route.Models, any(struct{}{}))
 		}
-		return
+	}
+}
+
+// modelsError returns an error if the number of Models is different from the
+// number of parameters in the path.
+func (route *Route) modelsError() error {
+	nParams := countRequiredParams(route.URL)
+	if len(route.Models) == nParams {
+		return nil
 	}
 	modelsNames := []string{}
 	for _, m := range route.Models {
 		modelsNames = append(modelsNames, reflect.TypeOf(m).Name())
 	}
 
-	msg := fmt.Sprintf("when providing Models to a route, the number of models should equal to the number of parameters in the path.\n"+
-		"the path %q requires %d parameters, but %v where provide.", route.URL, nParams, modelsNames)
-	fmt.Println(msg)
+	return fmt.Errorf("when providing Models to a route, the number of models should equal to the number of parameters in the path. "+
+		"the path %q requires %d parameters, but %v where provide", route.URL, nParams, modelsNames)
+}
+
+// RouteFrom returns the route matched by the dispatcher for the request with the given context.
+// It returns nil if the request didn't match any route.
+func RouteFrom(ctx context.Context) *Route {
+	route, _ := ctx.Value(tRoute).(*Route)
+	return route
 }